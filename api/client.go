@@ -20,7 +20,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"runtime"
@@ -33,8 +32,9 @@ import (
 // Client encapsulates client state for interacting with the ollama
 // service. Use [ClientFromEnvironment] to create new Clients.
 type Client struct {
-	base *url.URL
-	http *http.Client
+	base   *url.URL
+	http   *http.Client
+	apiKey string
 }
 
 func checkError(resp *http.Response, body []byte) error {
@@ -58,19 +58,30 @@ func checkError(resp *http.Response, body []byte) error {
 // port on which the ollama service is listenting. The format of this variable
 // is:
 //
-//	<scheme>://<host>:<port>
+//	<scheme>://[<user>[:<password>]@]<host>:<port>[/<path>]
+//
+// A path is kept as a prefix for every API route, for servers running
+// behind a reverse proxy under a subpath.
 //
 // If the variable is not specified, a default ollama host and port will be
-// used.
+// used. OLLAMA_API_KEY, if set, is sent as a bearer token.
 func ClientFromEnvironment() (*Client, error) {
 	ollamaHost := envconfig.Host
 
+	hostport, err := ollamaHost.HostPort()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Client{
 		base: &url.URL{
 			Scheme: ollamaHost.Scheme,
-			Host:   net.JoinHostPort(ollamaHost.Host, ollamaHost.Port),
+			Host:   hostport,
+			User:   ollamaHost.User,
+			Path:   ollamaHost.Path,
 		},
-		http: http.DefaultClient,
+		http:   http.DefaultClient,
+		apiKey: envconfig.APIKey,
 	}, nil
 }
 
@@ -110,6 +121,9 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Accept", "application/json")
 	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+	if c.apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
 
 	respObj, err := c.http.Do(request)
 	if err != nil {
@@ -156,6 +170,9 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Accept", "application/x-ndjson")
 	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+	if c.apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
 
 	response, err := c.http.Do(request)
 	if err != nil {
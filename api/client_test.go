@@ -28,6 +28,9 @@ func TestClientFromEnvironment(t *testing.T) {
 		"scheme, hostname, and port": {value: "https://example.com:1234", expect: "https://example.com:1234"},
 		"trailing slash":             {value: "example.com/", expect: "http://example.com:11434"},
 		"trailing slash port":        {value: "example.com:1234/", expect: "http://example.com:1234"},
+		"subpath":                    {value: "https://gw.example.com/ollama", expect: "https://gw.example.com:443/ollama"},
+		"subpath trailing slash":     {value: "https://gw.example.com/ollama/", expect: "https://gw.example.com:443/ollama"},
+		"nested subpath and port":    {value: "gw.example.com:8080/a/b//", expect: "http://gw.example.com:8080/a/b"},
 	}
 
 	for k, v := range testCases {
@@ -43,6 +46,10 @@ func TestClientFromEnvironment(t *testing.T) {
 			if client.base.String() != v.expect {
 				t.Fatalf("expected %s, got %s", v.expect, client.base.String())
 			}
+
+			if u, want := client.base.JoinPath("/api/tags").String(), v.expect+"/api/tags"; u != want {
+				t.Fatalf("expected %s, got %s", want, u)
+			}
 		})
 	}
 }
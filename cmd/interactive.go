@@ -154,15 +154,11 @@ func generateInteractive(cmd *cobra.Command, opts runOptions) error {
 		AltPrompt:      "... ",
 		Placeholder:    "Send a message (/? for help)",
 		AltPlaceholder: `Use """ to end multi-line input`,
-	})
+	}, envconfig.HistoryFile())
 	if err != nil {
 		return err
 	}
 
-	if envconfig.NoHistory {
-		scanner.HistoryDisable()
-	}
-
 	fmt.Print(readline.StartBracketedPaste)
 	defer fmt.Printf(readline.EndBracketedPaste)
 
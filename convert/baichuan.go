@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type BaichuanModel struct {
+	ModelData
+}
+
+// alibi reports whether the model uses ALiBi rather than rotary position
+// embeddings. The 13B models use ALiBi and, unlike the 7B models, don't set
+// max_position_embeddings, only model_max_length.
+func (m *BaichuanModel) alibi() bool {
+	return m.Params.ContextSize == 0
+}
+
+func (m *BaichuanModel) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range t {
+		if strings.HasSuffix(l.Name, "attn_qkv.weight") {
+			qkv, err := m.splitQKV(l)
+			if err != nil {
+				return err
+			}
+
+			m.Tensors = append(m.Tensors, qkv...)
+			continue
+		}
+
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	return nil
+}
+
+// splitQKV splits the fused W_pack projection, which holds all of q, then k,
+// then v, into attn_q, attn_k and attn_v. Each split tensor reads the whole
+// projection and keeps its own rows.
+func (m *BaichuanModel) splitQKV(t llm.Tensor) ([]llm.Tensor, error) {
+	if len(t.Shape) != 2 || t.Shape[0] != 3*t.Shape[1] {
+		return nil, fmt.Errorf("%s: shape %v isn't q, k and v of the hidden size", t.Name, t.Shape)
+	}
+
+	hidden := t.Shape[1]
+	prefix := strings.TrimSuffix(t.Name, "attn_qkv.weight")
+
+	var ts []llm.Tensor
+	for i, name := range []string{"attn_q", "attn_k", "attn_v"} {
+		split := llm.Tensor{
+			Name:  prefix + name + ".weight",
+			Kind:  t.Kind,
+			Shape: []uint64{hidden, hidden},
+		}
+
+		wt := t.WriterTo.(safetensorWriterTo)
+		wt.t = &split
+		wt.repacker = func(name string, data []float32, shape []uint64) ([]float32, error) {
+			size := hidden * hidden
+			f32s := data[uint64(i)*size : uint64(i+1)*size]
+
+			// with rotary embeddings q and k need the same permutation
+			// as llama
+			if i < 2 && !m.alibi() {
+				return llamaRepack(name, m.Params, f32s, shape)
+			}
+
+			return f32s, nil
+		}
+
+		split.WriterTo = wt
+		ts = append(ts, split)
+	}
+
+	return ts, nil
+}
+
+func (m *BaichuanModel) LoadVocab() error {
+	v, err := LoadSentencePieceTokens(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+	m.Vocab = v
+	return nil
+}
+
+func (m *BaichuanModel) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":                      "baichuan",
+		"general.name":                              m.Name,
+		"baichuan.context_length":                   uint32(cmp.Or(m.Params.ContextSize, m.Params.ModelMaxLength)),
+		"baichuan.embedding_length":                 uint32(m.Params.HiddenSize),
+		"baichuan.block_count":                      uint32(m.Params.HiddenLayers),
+		"baichuan.feed_forward_length":              uint32(m.Params.IntermediateSize),
+		"baichuan.attention.head_count":             uint32(m.Params.AttentionHeads),
+		"baichuan.attention.head_count_kv":          uint32(m.Params.AttentionHeads),
+		"baichuan.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
+		"tokenizer.ggml.model":                      "llama",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.scores":     m.Vocab.Scores,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+
+		"tokenizer.ggml.bos_token_id":     uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":     uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.padding_token_id": uint32(m.Params.PaddingTokenID),
+		"tokenizer.ggml.add_bos_token":    false,
+		"tokenizer.ggml.add_eos_token":    false,
+	}
+
+	if m.alibi() {
+		kv["baichuan.attention.max_alibi_bias"] = float32(8)
+	} else {
+		kv["baichuan.rope.dimension_count"] = uint32(m.Params.headDim())
+		kv["baichuan.rope.freq_base"] = m.Params.ropeFreqBase()
+	}
+
+	return m.writeGGUF(ws, kv)
+}
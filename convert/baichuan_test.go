@@ -0,0 +1,179 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func testBaichuanDir(t *testing.T, config map[string]any, wpack []float32) string {
+	t.Helper()
+
+	const hidden = 4
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", config)
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+	writeSafetensors(t, dir,
+		safetensor{name: "model.embed_tokens.weight", shape: []uint64{6, hidden}},
+		safetensor{name: "model.layers.0.input_layernorm.weight", shape: []uint64{hidden}},
+		safetensor{name: "model.layers.0.self_attn.W_pack.weight", shape: []uint64{3 * hidden, hidden}, data: wpack},
+		safetensor{name: "model.layers.0.self_attn.o_proj.weight", shape: []uint64{hidden, hidden}},
+		safetensor{name: "model.layers.0.post_attention_layernorm.weight", shape: []uint64{hidden}},
+		safetensor{name: "model.layers.0.mlp.gate_proj.weight", shape: []uint64{8, hidden}},
+		safetensor{name: "model.layers.0.mlp.up_proj.weight", shape: []uint64{8, hidden}},
+		safetensor{name: "model.layers.0.mlp.down_proj.weight", shape: []uint64{hidden, 8}},
+		safetensor{name: "model.norm.weight", shape: []uint64{hidden}},
+		safetensor{name: "lm_head.weight", shape: []uint64{6, hidden}},
+	)
+
+	return dir
+}
+
+func TestConvertBaichuan(t *testing.T) {
+	// every element of the fused projection holds its row number
+	wpack := make([]float32, 12*4)
+	for i := range wpack {
+		wpack[i] = float32(i / 4)
+	}
+
+	base := map[string]any{
+		"architectures":       []string{"BaichuanForCausalLM"},
+		"hidden_size":         4,
+		"intermediate_size":   8,
+		"num_attention_heads": 2,
+		"num_hidden_layers":   1,
+		"rms_norm_eps":        1e-6,
+	}
+
+	cases := []struct {
+		name   string
+		config map[string]any
+		expect map[string]any
+		absent []string
+	}{
+		{
+			name:   "7B rope",
+			config: map[string]any{"max_position_embeddings": 4096},
+			expect: map[string]any{
+				"baichuan.context_length":       uint32(4096),
+				"baichuan.rope.dimension_count": uint32(2),
+				"baichuan.rope.freq_base":       float32(10000),
+			},
+			absent: []string{"baichuan.attention.max_alibi_bias"},
+		},
+		{
+			name:   "13B alibi",
+			config: map[string]any{"model_max_length": 4096},
+			expect: map[string]any{
+				"baichuan.context_length":           uint32(4096),
+				"baichuan.attention.max_alibi_bias": float32(8),
+			},
+			absent: []string{"baichuan.rope.dimension_count", "baichuan.rope.freq_base"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			config := make(map[string]any)
+			for k, v := range base {
+				config[k] = v
+			}
+			for k, v := range tt.config {
+				config[k] = v
+			}
+
+			dir := testBaichuanDir(t, config, wpack)
+			kv, tensors := convertDir(t, dir)
+
+			tt.expect["general.architecture"] = "baichuan"
+			tt.expect["baichuan.embedding_length"] = uint32(4)
+			tt.expect["baichuan.attention.head_count"] = uint32(2)
+			tt.expect["baichuan.attention.head_count_kv"] = uint32(2)
+			tt.expect["baichuan.attention.layer_norm_rms_epsilon"] = float32(1e-6)
+			for k, v := range tt.expect {
+				if got := kv[k]; got != v {
+					t.Errorf("expected %s %v, got %v", k, v, got)
+				}
+			}
+
+			for _, k := range tt.absent {
+				if _, ok := kv[k]; ok {
+					t.Errorf("unexpected %s", k)
+				}
+			}
+
+			var names []string
+			for _, t := range tensors {
+				names = append(names, t.Name)
+			}
+
+			if slices.Contains(names, "blk.0.attn_qkv.weight") {
+				t.Error("unexpected fused blk.0.attn_qkv.weight")
+			}
+
+			for _, name := range []string{"blk.0.attn_q.weight", "blk.0.attn_k.weight", "blk.0.attn_v.weight"} {
+				if !slices.Contains(names, name) {
+					t.Errorf("missing tensor %s", name)
+				}
+			}
+		})
+	}
+
+	t.Run("split", func(t *testing.T) {
+		config := make(map[string]any)
+		for k, v := range base {
+			config[k] = v
+		}
+		config["model_max_length"] = 4096
+
+		dir := testBaichuanDir(t, config, wpack)
+
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.OutputType = "F32"
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*BaichuanModel)
+		for name, rows := range map[string][]float32{
+			"blk.0.attn_q.weight": {0, 1, 2, 3},
+			"blk.0.attn_k.weight": {4, 5, 6, 7},
+			"blk.0.attn_v.weight": {8, 9, 10, 11},
+		} {
+			i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == name })
+			if i < 0 {
+				t.Fatalf("missing %s", name)
+			}
+
+			var b bytes.Buffer
+			if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]float32, 16)
+			if err := binary.Read(&b, binary.LittleEndian, got); err != nil {
+				t.Fatal(err)
+			}
+
+			// without rotary embeddings nothing is permuted
+			for k, f := range got {
+				if want := rows[k/4]; f != want {
+					t.Fatalf("%s: expected %v at %d, got %v", name, want, k, f)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package convert
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+const (
+	poolingTypeNone uint32 = iota
+	poolingTypeMean
+	poolingTypeCLS
+)
+
+type BertModel struct {
+	ModelData
+
+	// PoolingType is how token embeddings are combined into a single
+	// sentence embedding
+	PoolingType uint32
+}
+
+func (m *BertModel) GetTensors() error {
+	switch m.Params.PositionEmbeddingType {
+	case "", "absolute":
+	default:
+		return fmt.Errorf("bert: unsupported position embedding type %q", m.Params.PositionEmbeddingType)
+	}
+
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	var pooler bool
+	for _, l := range t {
+		// the pooler is only used for next sentence prediction
+		if strings.HasPrefix(l.Name, "pooler.") {
+			pooler = true
+			continue
+		}
+
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	m.PoolingType, err = bertPoolingType(m.Path, pooler)
+	return err
+}
+
+// bertPoolingType reads the pooling mode from a sentence-transformers
+// config. Without one, checkpoints trained with a pooler use the [CLS] token
+// and everything else is mean pooled.
+func bertPoolingType(dirpath string, pooler bool) (uint32, error) {
+	f, err := os.Open(filepath.Join(dirpath, "1_Pooling", "config.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		if pooler {
+			return poolingTypeCLS, nil
+		}
+
+		return poolingTypeMean, nil
+	} else if err != nil {
+		return poolingTypeNone, err
+	}
+	defer f.Close()
+
+	var config struct {
+		CLS  bool `json:"pooling_mode_cls_token"`
+		Mean bool `json:"pooling_mode_mean_tokens"`
+	}
+
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return poolingTypeNone, err
+	}
+
+	switch {
+	case config.CLS:
+		return poolingTypeCLS, nil
+	case config.Mean:
+		return poolingTypeMean, nil
+	default:
+		return poolingTypeNone, nil
+	}
+}
+
+func (m *BertModel) LoadVocab() error {
+	v, err := LoadWordPieceTokens(m.Path)
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = v
+	return nil
+}
+
+// LoadWordPieceTokens reads a WordPiece vocabulary from vocab.txt, falling
+// back to tokenizer.json. Continuation pieces lose their "##" prefix and
+// word-initial pieces gain a "▁" prefix so the runner can tell them apart.
+func LoadWordPieceTokens(dirpath string) (*Vocab, error) {
+	var tokens []Token
+	f, err := os.Open(filepath.Join(dirpath, "vocab.txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		_, tokens, _, err = parseTokens(filepath.Join(dirpath, "tokenizer.json"))
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			tokens = append(tokens, Token{ID: len(tokens), Content: scanner.Text()})
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	v := &Vocab{}
+	for _, t := range tokens {
+		content := t.Content
+		switch {
+		case strings.HasPrefix(content, "[") && strings.HasSuffix(content, "]"):
+			t.Special = true
+		case strings.HasPrefix(content, "##"):
+			content = content[2:]
+		default:
+			content = "▁" + content
+		}
+
+		v.Tokens = append(v.Tokens, content)
+		v.Scores = append(v.Scores, 0)
+		v.Types = append(v.Types, t.Type())
+	}
+
+	slog.Info(fmt.Sprintf("vocab size: %d", len(v.Tokens)))
+	return v, nil
+}
+
+// tokenID returns the id of a special token such as [CLS].
+func (v *Vocab) tokenID(s string) (uint32, bool) {
+	for i, t := range v.Tokens {
+		if t == s {
+			return uint32(i), true
+		}
+	}
+
+	return 0, false
+}
+
+func (m *BertModel) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":              "bert",
+		"general.name":                      m.Name,
+		"bert.context_length":               uint32(m.Params.ContextSize),
+		"bert.embedding_length":             uint32(m.Params.HiddenSize),
+		"bert.block_count":                  uint32(m.Params.HiddenLayers),
+		"bert.feed_forward_length":          uint32(m.Params.IntermediateSize),
+		"bert.attention.head_count":         uint32(m.Params.AttentionHeads),
+		"bert.attention.layer_norm_epsilon": float32(m.Params.LayerNormEPS),
+		"bert.attention.causal":             false,
+		"bert.pooling_type":                 m.PoolingType,
+		"tokenizer.ggml.model":              "bert",
+		"tokenizer.ggml.token_type_count":   uint32(m.Params.TypeVocabSize),
+		"tokenizer.ggml.tokens":             m.Vocab.Tokens,
+		"tokenizer.ggml.scores":             m.Vocab.Scores,
+		"tokenizer.ggml.token_type":         m.Vocab.Types,
+		"tokenizer.ggml.padding_token_id":   uint32(m.Params.PaddingTokenID),
+	}
+
+	for k, s := range map[string]string{
+		"tokenizer.ggml.cls_token_id":       "[CLS]",
+		"tokenizer.ggml.seperator_token_id": "[SEP]",
+		"tokenizer.ggml.unknown_token_id":   "[UNK]",
+		"tokenizer.ggml.mask_token_id":      "[MASK]",
+	} {
+		if id, ok := m.Vocab.tokenID(s); ok {
+			kv[k] = id
+		}
+	}
+
+	return m.writeGGUF(ws, kv)
+}
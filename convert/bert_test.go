@@ -0,0 +1,117 @@
+package convert
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testBertDir(t *testing.T, pooler bool) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":           []string{"BertModel"},
+		"hidden_size":             8,
+		"intermediate_size":       16,
+		"num_hidden_layers":       1,
+		"num_attention_heads":     2,
+		"max_position_embeddings": 16,
+		"type_vocab_size":         2,
+		"layer_norm_eps":          1e-12,
+		"position_embedding_type": "absolute",
+	})
+
+	vocab := []string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "[MASK]", "hello", "##s"}
+	if err := os.WriteFile(filepath.Join(dir, "vocab.txt"), []byte(strings.Join(vocab, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := []safetensor{
+		{name: "embeddings.word_embeddings.weight", shape: []uint64{7, 8}},
+		{name: "embeddings.position_embeddings.weight", shape: []uint64{16, 8}},
+		{name: "embeddings.token_type_embeddings.weight", shape: []uint64{2, 8}},
+		{name: "embeddings.LayerNorm.weight", shape: []uint64{8}},
+		{name: "embeddings.LayerNorm.bias", shape: []uint64{8}},
+		{name: "encoder.layer.0.attention.self.query.weight", shape: []uint64{8, 8}},
+		{name: "encoder.layer.0.attention.self.query.bias", shape: []uint64{8}},
+		{name: "encoder.layer.0.attention.output.dense.weight", shape: []uint64{8, 8}},
+		{name: "encoder.layer.0.attention.output.LayerNorm.weight", shape: []uint64{8}},
+		{name: "encoder.layer.0.intermediate.dense.weight", shape: []uint64{16, 8}},
+		{name: "encoder.layer.0.output.dense.weight", shape: []uint64{8, 16}},
+		{name: "encoder.layer.0.output.LayerNorm.weight", shape: []uint64{8}},
+	}
+
+	if pooler {
+		ts = append(ts, safetensor{name: "pooler.dense.weight", shape: []uint64{8, 8}})
+	}
+
+	writeSafetensors(t, dir, ts...)
+	return dir
+}
+
+func TestConvertBert(t *testing.T) {
+	kv, tensors := convertDir(t, testBertDir(t, false))
+
+	expect := map[string]any{
+		"general.architecture":              "bert",
+		"bert.embedding_length":             uint32(8),
+		"bert.feed_forward_length":          uint32(16),
+		"bert.attention.head_count":         uint32(2),
+		"bert.attention.causal":             false,
+		"bert.pooling_type":                 poolingTypeMean,
+		"tokenizer.ggml.model":              "bert",
+		"tokenizer.ggml.token_type_count":   uint32(2),
+		"tokenizer.ggml.cls_token_id":       uint32(2),
+		"tokenizer.ggml.seperator_token_id": uint32(3),
+	}
+
+	for k, v := range expect {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	tokens, err := json.Marshal(kv["tokenizer.ggml.tokens"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := `["[PAD]","[UNK]","[CLS]","[SEP]","[MASK]","▁hello","s"]`; string(tokens) != expect {
+		t.Errorf("expected tokens %s, got %s", expect, tokens)
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	for _, name := range []string{"token_types.weight", "token_embd_norm.bias", "blk.0.attn_q.bias", "blk.0.attn_output_norm.weight", "blk.0.layer_output_norm.weight"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("expected tensor %s, got %v", name, names)
+		}
+	}
+}
+
+func TestConvertBertPooler(t *testing.T) {
+	dir := testBertDir(t, true)
+
+	kv, tensors := convertDir(t, dir)
+	if got := kv["bert.pooling_type"]; got != poolingTypeCLS {
+		t.Errorf("expected cls pooling, got %v", got)
+	}
+
+	for _, tensor := range tensors {
+		if strings.HasPrefix(tensor.Name, "pooler.") {
+			t.Errorf("expected pooler to be dropped, got %s", tensor.Name)
+		}
+	}
+
+	writeJSON(t, dir, "1_Pooling/config.json", map[string]any{"pooling_mode_mean_tokens": true})
+	if kv, _ := convertDir(t, dir); kv["bert.pooling_type"] != poolingTypeMean {
+		t.Errorf("expected mean pooling from sentence-transformers config, got %v", kv["bert.pooling_type"])
+	}
+}
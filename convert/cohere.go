@@ -0,0 +1,129 @@
+package convert
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// CohereModel converts Command-R and Command-R-Plus, written as command-r,
+// and the Command-R7B generation, written as cohere2.
+type CohereModel struct {
+	ModelData
+}
+
+func (m *CohereModel) arch() string {
+	if slices.Contains(m.Params.Architectures, "Cohere2ForCausalLM") {
+		return "cohere2"
+	}
+
+	return "command-r"
+}
+
+func (m *CohereModel) GetTensors() error {
+	// cohere's rotary embeddings rotate interleaved pairs, which is what
+	// the runner expects, so unlike llama q and k don't need repacking.
+	// Command-R-Plus adds per head q and k norms which are written as is
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	heads, kvHeads, headDim := m.Params.AttentionHeads, m.Params.kvHeads(), m.Params.headDim()
+
+	var norms int
+	for _, l := range t {
+		var want []uint64
+		switch {
+		case strings.HasSuffix(l.Name, "attn_q_norm.weight"):
+			want = []uint64{uint64(heads), uint64(headDim)}
+		case strings.HasSuffix(l.Name, "attn_k_norm.weight"):
+			want = []uint64{uint64(kvHeads), uint64(headDim)}
+		}
+
+		if want != nil {
+			if !slices.Equal(l.Shape, want) {
+				return fmt.Errorf("%s: shape %v doesn't match %v heads of %d", l.Name, l.Shape, want[0], headDim)
+			}
+
+			norms++
+		}
+
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	if m.Params.UseQKNorm && norms != 2*m.Params.HiddenLayers {
+		return fmt.Errorf("%s: use_qk_norm is set but %d of %d q and k norms were found", m.arch(), norms, 2*m.Params.HiddenLayers)
+	}
+
+	return nil
+}
+
+func (m *CohereModel) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *CohereModel) WriteGGUF(ws io.WriteSeeker) error {
+	arch := m.arch()
+
+	kv := llm.KV{
+		"general.architecture":                 arch,
+		"general.name":                         m.Name,
+		arch + ".context_length":               uint32(m.Params.ContextSize),
+		arch + ".embedding_length":             uint32(m.Params.HiddenSize),
+		arch + ".block_count":                  uint32(m.Params.HiddenLayers),
+		arch + ".feed_forward_length":          uint32(m.Params.IntermediateSize),
+		arch + ".rope.freq_base":               m.Params.ropeFreqBase(),
+		arch + ".attention.head_count":         uint32(m.Params.AttentionHeads),
+		arch + ".attention.head_count_kv":      uint32(m.Params.kvHeads()),
+		arch + ".attention.layer_norm_epsilon": float32(cmp.Or(m.Params.LayerNormEPS, 1e-5)),
+		arch + ".logit_scale":                  float32(cmp.Or(m.Params.LogitScale, 1)),
+
+		// the pretokenizer belongs to the architecture so it isn't
+		// detected from tokenizer.json
+		"tokenizer.ggml.model": "gpt2",
+		"tokenizer.ggml.pre":   "command-r",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id":     uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":     uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.padding_token_id": uint32(m.Params.PaddingTokenID),
+		"tokenizer.ggml.add_bos_token":    true,
+		"tokenizer.ggml.add_eos_token":    false,
+	}
+
+	if arch == "cohere2" {
+		// layers interleave sliding window attention, with rotary
+		// embeddings, and full attention without any
+		pattern, err := m.Params.slidingWindowLayers("cohere2", 4)
+		if err != nil {
+			return err
+		}
+
+		kv["cohere2.attention.sliding_window"] = uint32(m.Params.SlidingWindow)
+		kv["cohere2.attention.sliding_window_pattern"] = pattern
+		kv["cohere2.rope.dimension_count"] = uint32(cmp.Or(m.Params.RotaryPct, 1) * float64(m.Params.headDim()))
+	}
+
+	return m.writeGGUF(ws, kv)
+}
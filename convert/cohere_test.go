@@ -0,0 +1,234 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func testCohereDir(t *testing.T, config map[string]any, layers int, qkNorm bool) string {
+	t.Helper()
+
+	const hidden, heads, kvHeads = 8, 4, 2
+
+	cfg := map[string]any{
+		"hidden_size":             hidden,
+		"intermediate_size":       16,
+		"num_attention_heads":     heads,
+		"num_key_value_heads":     kvHeads,
+		"num_hidden_layers":       layers,
+		"max_position_embeddings": 8192,
+		"layer_norm_eps":          1e-5,
+		"logit_scale":             0.125,
+		"rope_theta":              75000000,
+		"tie_word_embeddings":     true,
+	}
+	for k, v := range config {
+		cfg[k] = v
+	}
+
+	ts := []safetensor{
+		{name: "model.embed_tokens.weight", shape: []uint64{6, hidden}},
+		{name: "model.norm.weight", shape: []uint64{hidden}},
+	}
+
+	for i := range layers {
+		prefix := fmt.Sprintf("model.layers.%d.", i)
+		ts = append(ts,
+			safetensor{name: prefix + "input_layernorm.weight", shape: []uint64{hidden}},
+			safetensor{name: prefix + "self_attn.q_proj.weight", shape: []uint64{hidden, hidden}},
+			safetensor{name: prefix + "self_attn.k_proj.weight", shape: []uint64{kvHeads * 2, hidden}},
+			safetensor{name: prefix + "self_attn.v_proj.weight", shape: []uint64{kvHeads * 2, hidden}},
+			safetensor{name: prefix + "self_attn.o_proj.weight", shape: []uint64{hidden, hidden}},
+			safetensor{name: prefix + "mlp.gate_proj.weight", shape: []uint64{16, hidden}},
+			safetensor{name: prefix + "mlp.up_proj.weight", shape: []uint64{16, hidden}},
+			safetensor{name: prefix + "mlp.down_proj.weight", shape: []uint64{hidden, 16}},
+		)
+
+		if qkNorm {
+			ts = append(ts,
+				safetensor{name: prefix + "self_attn.q_norm.weight", shape: []uint64{heads, 2}},
+				safetensor{name: prefix + "self_attn.k_norm.weight", shape: []uint64{kvHeads, 2}},
+			)
+		}
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", cfg)
+	writeBPETokenizer(t, dir)
+	writeSafetensors(t, dir, ts...)
+	return dir
+}
+
+func TestConvertCommandRPlus(t *testing.T) {
+	dir := testCohereDir(t, map[string]any{
+		"architectures": []string{"CohereForCausalLM"},
+		"use_qk_norm":   true,
+	}, 1, true)
+
+	kv, tensors := convertDir(t, dir)
+
+	expect := map[string]any{
+		"general.architecture":                   "command-r",
+		"command-r.context_length":               uint32(8192),
+		"command-r.embedding_length":             uint32(8),
+		"command-r.block_count":                  uint32(1),
+		"command-r.feed_forward_length":          uint32(16),
+		"command-r.rope.freq_base":               float32(75000000),
+		"command-r.attention.head_count":         uint32(4),
+		"command-r.attention.head_count_kv":      uint32(2),
+		"command-r.attention.layer_norm_epsilon": float32(1e-5),
+		"command-r.logit_scale":                  float32(0.125),
+		"tokenizer.ggml.pre":                     "command-r",
+	}
+
+	for k, v := range expect {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	if _, ok := kv["command-r.attention.sliding_window_pattern"]; ok {
+		t.Error("unexpected sliding window pattern for command-r")
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	for _, name := range []string{"blk.0.attn_q_norm.weight", "blk.0.attn_k_norm.weight"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("missing tensor %s", name)
+		}
+	}
+
+	t.Run("missing qk norm", func(t *testing.T) {
+		dir := testCohereDir(t, map[string]any{
+			"architectures": []string{"CohereForCausalLM"},
+			"use_qk_norm":   true,
+		}, 1, false)
+
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err == nil {
+			t.Error("expected an error for use_qk_norm without q and k norms")
+		}
+	})
+}
+
+func TestConvertCohere2(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]any
+		expect []bool
+	}{
+		{
+			name:   "default pattern",
+			config: map[string]any{},
+			expect: []bool{true, true, true, false, true, true, true, false},
+		},
+		{
+			name:   "sliding window pattern",
+			config: map[string]any{"sliding_window_pattern": 2},
+			expect: []bool{true, false, true, false, true, false, true, false},
+		},
+		{
+			name: "layer types",
+			config: map[string]any{
+				"sliding_window_pattern": 4,
+				"layer_types": []string{
+					"sliding_attention", "full_attention", "sliding_attention", "sliding_attention",
+					"full_attention", "sliding_attention", "sliding_attention", "full_attention",
+				},
+			},
+			expect: []bool{true, false, true, true, false, true, true, false},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config["architectures"] = []string{"Cohere2ForCausalLM"}
+			tt.config["sliding_window"] = 4096
+
+			kv, _ := convertDir(t, testCohereDir(t, tt.config, 8, false))
+
+			expect := map[string]any{
+				"general.architecture":                 "cohere2",
+				"cohere2.block_count":                  uint32(8),
+				"cohere2.attention.head_count":         uint32(4),
+				"cohere2.attention.head_count_kv":      uint32(2),
+				"cohere2.attention.sliding_window":     uint32(4096),
+				"cohere2.rope.dimension_count":         uint32(2),
+				"cohere2.logit_scale":                  float32(0.125),
+				"cohere2.attention.layer_norm_epsilon": float32(1e-5),
+			}
+
+			for k, v := range expect {
+				if got := kv[k]; got != v {
+					t.Errorf("expected %s %v, got %v", k, v, got)
+				}
+			}
+
+			got, err := json.Marshal(kv["cohere2.attention.sliding_window_pattern"])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := json.Marshal(tt.expect)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != string(want) {
+				t.Errorf("expected sliding window pattern %s, got %s", want, got)
+			}
+		})
+	}
+
+	t.Run("mismatched layer types", func(t *testing.T) {
+		dir := testCohereDir(t, map[string]any{
+			"architectures": []string{"Cohere2ForCausalLM"},
+			"layer_types":   []string{"sliding_attention", "full_attention"},
+		}, 4, false)
+
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.LoadVocab(); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "model.gguf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := arch.WriteGGUF(f); err == nil {
+			t.Error("expected an error for layer_types not matching the number of layers")
+		}
+	})
+}
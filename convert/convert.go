@@ -4,12 +4,17 @@ import (
 	"cmp"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
 	"google.golang.org/protobuf/proto"
@@ -43,15 +48,343 @@ type Params struct {
 	HeadDimension     int      `json:"head_dim"`
 	PaddingTokenID    int      `json:"pad_token_id"`
 	RopeFrequencyBase float64  `json:"rope_theta"`
+	TieWordEmbeddings bool     `json:"tie_word_embeddings"`
+
+	// encoder only
+	LayerNormEPS          float64 `json:"layer_norm_eps"`
+	TypeVocabSize         int     `json:"type_vocab_size"`
+	PositionEmbeddingType string  `json:"position_embedding_type"`
+
+	// gpt-neox, stablelm
+	ParallelResidual    *bool   `json:"use_parallel_residual"`
+	RotaryPct           float64 `json:"rotary_pct"`
+	PartialRotaryFactor float64 `json:"partial_rotary_factor"`
+	QKLayerNorm         bool    `json:"qk_layernorm"`
+
+	// falcon, including the older RW config names
+	NumHeads               int     `json:"n_head"`
+	NumLayers              int     `json:"n_layer"`
+	NumKVHeads             int     `json:"num_kv_heads"`
+	NumHeadKV              int     `json:"n_head_kv"`
+	MultiQuery             bool    `json:"multi_query"`
+	NewDecoderArchitecture bool    `json:"new_decoder_architecture"`
+	ParallelAttention      *bool   `json:"parallel_attn"`
+	Alibi                  bool    `json:"alibi"`
+	LayerNormEpsilon       float64 `json:"layer_norm_epsilon"`
+
+	// gpt2
+	EmbeddingSize int `json:"n_embd"`
+	Positions     int `json:"n_positions"`
+	InnerSize     int `json:"n_inner"`
+
+	// baichuan 13B has no max_position_embeddings
+	ModelMaxLength int `json:"model_max_length"`
+
+	// starcoder2
+	NormEpsilon   float64 `json:"norm_epsilon"`
+	SlidingWindow int     `json:"sliding_window"`
+
+	// deepseek2
+	FirstKDenseReplace  int          `json:"first_k_dense_replace"`
+	RoutedExperts       int          `json:"n_routed_experts"`
+	SharedExperts       int          `json:"n_shared_experts"`
+	RoutedScalingFactor float64      `json:"routed_scaling_factor"`
+	QLoRARank           int          `json:"q_lora_rank"`
+	KVLoRARank          int          `json:"kv_lora_rank"`
+	QKNopeHeadDim       int          `json:"qk_nope_head_dim"`
+	QKRopeHeadDim       int          `json:"qk_rope_head_dim"`
+	VHeadDim            int          `json:"v_head_dim"`
+	RopeScaling         *ropeScaling `json:"rope_scaling"`
+
+	// gemma2, which the gemma converter refuses
+	FinalLogitSoftcap *float64 `json:"final_logit_softcapping"`
+	AttnLogitSoftcap  *float64 `json:"attn_logit_softcapping"`
+
+	// gemma3
+	RopeLocalBaseFreq float64 `json:"rope_local_base_freq"`
+
+	// nemotron, whose norm_eps is a layer norm's rather than rms_norm_eps
+	HiddenAct string  `json:"hidden_act"`
+	NormEps   float64 `json:"norm_eps"`
+
+	// cohere
+	LogitScale           float64  `json:"logit_scale"`
+	UseQKNorm            bool     `json:"use_qk_norm"`
+	SlidingWindowPattern int      `json:"sliding_window_pattern"`
+	LayerTypes           []string `json:"layer_types"`
+
+	// mpt, dbrx
+	ModelDim       int        `json:"d_model"`
+	ModelHeads     int        `json:"n_heads"`
+	ModelLayers    int        `json:"n_layers"`
+	MaxSeqLen      int        `json:"max_seq_len"`
+	ExpansionRatio float64    `json:"expansion_ratio"`
+	AttnConfig     attnConfig `json:"attn_config"`
+	FFNConfig      ffnConfig  `json:"ffn_config"`
 
 	Experts     int `json:"num_local_experts"`
 	ExpertsUsed int `json:"num_experts_per_tok"`
 
+	// olmo
+	ModelKVHeads        int      `json:"n_kv_heads"`
+	MaxSequenceLength   int      `json:"max_sequence_length"`
+	MLPRatio            float64  `json:"mlp_ratio"`
+	MLPHiddenSize       int      `json:"mlp_hidden_size"`
+	ClipQKV             *float64 `json:"clip_qkv"`
+	IncludeBias         bool     `json:"include_bias"`
+	LayerNormWithAffine bool     `json:"layer_norm_with_affine"`
+	AttentionLayerNorm  bool     `json:"attention_layer_norm"`
+
+	// qwen2moe
+	NumExperts                   int `json:"num_experts"`
+	MoEIntermediateSize          int `json:"moe_intermediate_size"`
+	SharedExpertIntermediateSize int `json:"shared_expert_intermediate_size"`
+
 	PreTokenizer string
 
+	// Overrides are applied to the architecture's metadata just before the
+	// GGUF is written
+	Overrides map[string]any `json:"-"`
+
+	// SourceMetadata copies scalar config.json fields that aren't otherwise
+	// used into general.source.*
+	SourceMetadata bool `json:"-"`
+
+	// Verify re-reads the GGUF after it's written and checks it against the
+	// metadata and tensors that were meant to be written
+	Verify bool `json:"-"`
+
+	// AutoMap points at custom modelling code shipped with the model
+	AutoMap map[string]any `json:"auto_map"`
+
+	// TrustRemoteCode allows converting models whose auto_map refers to custom
+	// code the converter doesn't implement
+	TrustRemoteCode bool `json:"-"`
+
+	// SkipTensors are regular expressions matched against source tensor
+	// names, e.g. `rotary_emb\.inv_freq$`. Matching tensors aren't written
+	SkipTensors []string `json:"-"`
+
+	// RenameTensors maps source tensor names to the names they're converted
+	// as, for checkpoints with names the architecture doesn't know. They're
+	// renamed before the architecture maps them to GGUF names
+	RenameTensors map[string]string `json:"-"`
+
+	// OutputByteOrder is the byte order of the GGUF that's written, for
+	// big-endian hosts such as s390x. It defaults to little-endian
+	OutputByteOrder ByteOrder `json:"-"`
+
+	// GGUFVersion is the version of the GGUF format that's written, 2 for
+	// older runners or 3. It defaults to 3
+	GGUFVersion int `json:"-"`
+
+	// PadVocabTo pads the rows of the token embedding and output projection
+	// with zeros up to a multiple of it, for runners whose kernels want
+	// aligned dimensions. The true size is written as <arch>.vocab_size
+	PadVocabTo int `json:"-"`
+
+	// OutputType forces matrices to "F32" or "F16". When empty they keep the
+	// type they're stored as in the source checkpoint
+	OutputType string `json:"-"`
+
 	ByteOrder
 }
 
+// tensorKind returns the GGML type a tensor stored as dtype with dims
+// dimensions is written as. Anything other than a matrix is always F32.
+func (p *Params) tensorKind(dtype string, dims int) (uint32, error) {
+	if dims != 2 {
+		return tensorKindF32, nil
+	}
+
+	if p.OutputType != "" {
+		dtype = p.OutputType
+	}
+
+	switch dtype {
+	case "F32":
+		return tensorKindF32, nil
+	case "F16":
+		return tensorKindF16, nil
+	case "BF16":
+		return tensorKindBF16, nil
+	default:
+		return 0, fmt.Errorf("unsupported tensor type: %s", dtype)
+	}
+}
+
+// outputByteOrder returns the byte order the GGUF is written in.
+func (p *Params) outputByteOrder() ByteOrder {
+	if p == nil || p.OutputByteOrder == nil {
+		return binary.LittleEndian
+	}
+
+	return p.OutputByteOrder
+}
+
+// ggufVersion returns the version of the GGUF format that's written.
+func (p *Params) ggufVersion() uint32 {
+	if p == nil || p.GGUFVersion == 0 {
+		return 3
+	}
+
+	return uint32(p.GGUFVersion)
+}
+
+// tensorRenamer applies RenameTensors to source tensor names and reports an
+// error if two tensors end up with the same name.
+type tensorRenamer struct {
+	renames map[string]string
+
+	// seen maps each name given out to the source name it came from
+	seen map[string]string
+}
+
+func (p *Params) renamer() *tensorRenamer {
+	return &tensorRenamer{renames: p.RenameTensors, seen: make(map[string]string)}
+}
+
+func (r *tensorRenamer) rename(name string) (string, error) {
+	renamed := name
+	if to, ok := r.renames[name]; ok {
+		slog.Debug("renaming tensor", "from", name, "to", to)
+		renamed = to
+	}
+
+	if from, ok := r.seen[renamed]; ok {
+		return "", fmt.Errorf("rename tensors: %s and %s are both named %s", from, name, renamed)
+	}
+
+	r.seen[renamed] = name
+	return renamed, nil
+}
+
+// tensorSkipper matches source tensor names against the SkipTensors
+// patterns. Patterns aren't anchored so they match anywhere in the name.
+type tensorSkipper []*regexp.Regexp
+
+// skipper compiles SkipTensors, rejecting invalid patterns before any tensors
+// are read.
+func (p *Params) skipper() (tensorSkipper, error) {
+	s := make(tensorSkipper, len(p.SkipTensors))
+	for i, pattern := range p.SkipTensors {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("skip tensors: %w", err)
+		}
+
+		s[i] = re
+	}
+
+	return s, nil
+}
+
+func (s tensorSkipper) skipped(name string) bool {
+	for _, re := range s {
+		if re.MatchString(name) {
+			slog.Debug("skipping tensor", "name", name, "pattern", re)
+			return true
+		}
+	}
+
+	return false
+}
+
+var ErrRemoteCode = errors.New("model relies on custom code which the converter doesn't implement")
+
+// remoteCodeArchitectures have custom modelling code, referenced through
+// auto_map, which the converter implements itself.
+var remoteCodeArchitectures = []string{
+	"BaichuanForCausalLM",
+	"DbrxForCausalLM",
+	"DeepseekV2ForCausalLM",
+	"InternLM2ForCausalLM",
+	"MPTForCausalLM",
+	"OLMoForCausalLM",
+	"RWForCausalLM",
+}
+
+// checkRemoteCode refuses models relying on custom code through auto_map,
+// since converting them as their base architecture may silently produce a
+// broken model, unless the converter implements that code or TrustRemoteCode
+// is set.
+func (p *Params) checkRemoteCode() error {
+	if len(p.AutoMap) == 0 || p.TrustRemoteCode {
+		return nil
+	}
+
+	if len(p.Architectures) == 1 && slices.Contains(remoteCodeArchitectures, p.Architectures[0]) {
+		return nil
+	}
+
+	return fmt.Errorf("%w; set OLLAMA_TRUST_REMOTE_CODE=1 to convert it anyway", ErrRemoteCode)
+}
+
+// kvHeads returns the number of key/value heads. Configs without
+// num_key_value_heads use multi-head attention, with one key/value head for
+// each attention head.
+func (p *Params) kvHeads() int {
+	return cmp.Or(p.KeyValHeads, p.AttentionHeads)
+}
+
+// headDim returns the size of each attention head, deriving it from the
+// hidden size when the config omits head_dim.
+func (p *Params) headDim() int {
+	if p.HeadDimension > 0 {
+		return p.HeadDimension
+	}
+
+	if p.AttentionHeads > 0 {
+		return p.HiddenSize / p.AttentionHeads
+	}
+
+	return 0
+}
+
+// slidingWindowLayers returns whether each layer uses sliding window
+// attention, rather than full attention. layer_types lists each layer's
+// attention; older configs instead set sliding_window_pattern, where every
+// nth layer uses full attention, which defaults to every.
+func (p *Params) slidingWindowLayers(arch string, every int) ([]bool, error) {
+	layers := p.HiddenLayers
+	if len(p.LayerTypes) > 0 {
+		if len(p.LayerTypes) != layers {
+			return nil, fmt.Errorf("%s: %d layer types for %d layers", arch, len(p.LayerTypes), layers)
+		}
+
+		pattern := make([]bool, layers)
+		for i, t := range p.LayerTypes {
+			switch t {
+			case "sliding_attention":
+				pattern[i] = true
+			case "full_attention":
+			default:
+				return nil, fmt.Errorf("%s: layer %d has unknown attention type %q", arch, i, t)
+			}
+		}
+
+		return pattern, nil
+	}
+
+	n := cmp.Or(p.SlidingWindowPattern, every)
+	pattern := make([]bool, layers)
+	for i := range pattern {
+		pattern[i] = (i+1)%n != 0
+	}
+
+	return pattern, nil
+}
+
+// ropeFreqBase returns the rotary embedding base, defaulting to the 10000
+// used by the original llama when the config omits rope_theta.
+func (p *Params) ropeFreqBase() float32 {
+	if p.RopeFrequencyBase > 0 {
+		return float32(p.RopeFrequencyBase)
+	}
+
+	return 10000
+}
+
 type ByteOrder interface {
 	binary.ByteOrder
 	binary.AppendByteOrder
@@ -61,6 +394,7 @@ type ModelArch interface {
 	GetTensors() error
 	LoadVocab() error
 	WriteGGUF(io.WriteSeeker) error
+	MergeLoRA(string) error
 }
 
 type ModelFormat interface {
@@ -79,6 +413,548 @@ type ModelData struct {
 	Format  ModelFormat
 }
 
+// writeGGUF applies any metadata overrides to kv and encodes the model.
+func (m *ModelData) writeGGUF(ws io.WriteSeeker, kv llm.KV) error {
+	if m.Params.SourceMetadata {
+		source, err := sourceMetadata(filepath.Join(m.Path, "config.json"))
+		if err != nil {
+			return err
+		}
+
+		for k, v := range source {
+			kv[k] = v
+		}
+	}
+
+	kv["general.file_type"] = fileType(m.Tensors)
+
+	if err := applyOverrides(kv, m.Params.Overrides); err != nil {
+		return err
+	}
+
+	tensors := m.Tensors
+	if m.Params.TieWordEmbeddings {
+		// the runner reuses token_embd.weight when output.weight is absent
+		tensors = slices.DeleteFunc(slices.Clone(tensors), func(t llm.Tensor) bool {
+			return t.Name == "output.weight"
+		})
+	}
+
+	if m.Params.PadVocabTo > 0 {
+		tensors = padVocab(kv, tensors, m.Params.PadVocabTo)
+	}
+
+	tensors = layoutTensors(tensors)
+	if err := llm.NewGGUF(m.Params.outputByteOrder(), m.Params.ggufVersion()).Encode(ws, kv, tensors); err != nil {
+		return err
+	}
+
+	if m.Params.Verify {
+		rs, ok := ws.(io.ReadSeeker)
+		if !ok {
+			return errors.New("verify: output is not readable")
+		}
+
+		return verifyGGUF(rs, kv, len(tensors))
+	}
+
+	return nil
+}
+
+// EditGGUF writes the GGUF in r, which is size bytes long, to ws with
+// overrides applied to its metadata the same way as to a conversion's.
+// Tensors are copied as they are, so existing GGUFs can be imported with
+// edited metadata without reconverting.
+func EditGGUF(ws io.WriteSeeker, r io.ReaderAt, size int64, overrides map[string]any) error {
+	return llm.RewriteGGUF(ws, r, size, func(kv llm.KV) error {
+		return applyOverrides(kv, overrides)
+	})
+}
+
+// verifyGGUF decodes the GGUF in rs and checks that it's complete and that
+// its architecture, embedding length, block count and number of tensors
+// match kv and numTensors. rs is left positioned at its end.
+func verifyGGUF(rs io.ReadSeeker, kv llm.KV, numTensors int) error {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ggml, offset, err := llm.DecodeGGML(rs, 0)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	// decoding seeks over tensor data so a short file only shows up here
+	if offset > size {
+		return fmt.Errorf("verify: file is truncated, expected %d bytes but got %d", offset, size)
+	}
+
+	if n := len(ggml.Tensors()); n != numTensors {
+		return fmt.Errorf("verify: expected %d tensors but got %d", numTensors, n)
+	}
+
+	arch := kv.Architecture()
+	for _, k := range []string{
+		"general.architecture",
+		arch + ".embedding_length",
+		arch + ".block_count",
+	} {
+		want, ok := kv[k]
+		if !ok {
+			continue
+		}
+
+		if got := ggml.KV()[k]; got != want {
+			return fmt.Errorf("verify: expected %s to be %v but got %v", k, want, got)
+		}
+	}
+
+	return nil
+}
+
+const (
+	tensorKindF32  uint32 = 0
+	tensorKindF16  uint32 = 1
+	tensorKindBF16 uint32 = 30
+)
+
+// fileType returns the general.file_type for ts. Files which mix F32 with F16
+// or BF16 are labelled as mostly the more common 16 bit type, the same as
+// llama.cpp does; GGUF has no file type for mixed precision as such.
+func fileType(ts []llm.Tensor) uint32 {
+	var f16, bf16 int
+	for _, t := range ts {
+		switch t.Kind {
+		case tensorKindF16:
+			f16++
+		case tensorKindBF16:
+			bf16++
+		}
+	}
+
+	switch {
+	case bf16 > f16:
+		return 32 // MOSTLY_BF16
+	case f16 > 0:
+		return 1 // MOSTLY_F16
+	default:
+		return 0 // ALL_F32
+	}
+}
+
+// stackWriterTo writes each of its tensors in turn, e.g. to combine per-head
+// or per-expert tensors into a single tensor.
+type stackWriterTo []llm.Tensor
+
+func (ts stackWriterTo) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, t := range ts {
+		nn, err := t.WriteTo(w)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// expertRe matches per-expert feed forward tensors, e.g.
+// blk.0.ffn_gate.7.weight.
+var expertRe = regexp.MustCompile(`^blk\.(\d+)\.ffn_(gate|up|down)\.(\d+)\.weight$`)
+
+// stackExperts combines the per-expert feed forward tensors in t, which are
+// stored one tensor per expert, into a single ffn_*_exps tensor per layer.
+// Every layer with experts must have exactly experts of each. Other tensors
+// are returned as they are.
+func stackExperts(arch string, t []llm.Tensor, experts int) ([]llm.Tensor, error) {
+	var ts []llm.Tensor
+	stacks := make(map[string][]llm.Tensor)
+	for _, l := range t {
+		if matches := expertRe.FindStringSubmatch(l.Name); matches != nil {
+			name := fmt.Sprintf("blk.%s.ffn_%s_exps.weight", matches[1], matches[2])
+			stacks[name] = append(stacks[name], l)
+			continue
+		}
+
+		ts = append(ts, l)
+	}
+
+	names := make([]string, 0, len(stacks))
+	for name := range stacks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		stack := stacks[name]
+		if len(stack) != experts {
+			return nil, fmt.Errorf("%s: %s has %d experts, expected %d", arch, name, len(stack), experts)
+		}
+
+		// names sort lexically so experts.10 would come before experts.2
+		slices.SortFunc(stack, func(a, b llm.Tensor) int {
+			return cmp.Compare(expertIndex(a.Name), expertIndex(b.Name))
+		})
+
+		for _, t := range stack[1:] {
+			if !slices.Equal(t.Shape, stack[0].Shape) || t.Kind != stack[0].Kind {
+				return nil, fmt.Errorf("%s: %s doesn't match the shape or type of %s", arch, t.Name, stack[0].Name)
+			}
+		}
+
+		ts = append(ts, llm.Tensor{
+			Name:     name,
+			Kind:     stack[0].Kind,
+			Shape:    append([]uint64{uint64(len(stack))}, stack[0].Shape...),
+			WriterTo: stackWriterTo(stack),
+		})
+	}
+
+	return ts, nil
+}
+
+func expertIndex(name string) int {
+	n, _ := strconv.Atoi(expertRe.FindStringSubmatch(name)[3])
+	return n
+}
+
+// sourceMetadata returns the top level fields of the config at fn which
+// don't correspond to a Params field, keyed by general.source.<field>. Only
+// strings, numbers and bools are kept.
+func sourceMetadata(fn string) (llm.KV, error) {
+	bts, err := os.ReadFile(fn)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(bts, &fields); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	pt := reflect.TypeOf(Params{})
+	for i := range pt.NumField() {
+		name, _, _ := strings.Cut(pt.Field(i).Tag.Get("json"), ",")
+		known[name] = true
+	}
+
+	kv := make(llm.KV)
+	for k, v := range fields {
+		if known[k] {
+			continue
+		}
+
+		key := "general.source." + k
+		switch v := v.(type) {
+		case string, bool:
+			kv[key] = v
+		case float64:
+			if v >= 0 && v <= math.MaxUint32 && v == math.Trunc(v) {
+				kv[key] = uint32(v)
+			} else {
+				kv[key] = float32(v)
+			}
+		}
+	}
+
+	return kv, nil
+}
+
+// layoutTensors recomputes tensor offsets so they remain contiguous after
+// tensors have been removed or resized.
+func layoutTensors(ts []llm.Tensor) []llm.Tensor {
+	var offset uint64
+	for i := range ts {
+		ts[i].Offset = offset
+		offset += ts[i].Size()
+	}
+
+	return ts
+}
+
+// padVocab pads the rows of the token embedding and output projection in ts
+// with zeros up to a multiple of to. The unpadded vocabulary size is recorded
+// in kv unless the architecture already has, e.g. from its tokens. ts is left
+// as is, the padded tensors are returned in a copy.
+func padVocab(kv llm.KV, ts []llm.Tensor, to int) []llm.Tensor {
+	ts = slices.Clone(ts)
+	for i, t := range ts {
+		if t.Name != "token_embd.weight" && t.Name != "output.weight" {
+			continue
+		}
+
+		rows := t.Shape[0]
+		if _, ok := kv[kv.Architecture()+".vocab_size"]; !ok {
+			kv[kv.Architecture()+".vocab_size"] = uint32(rows)
+		}
+
+		padded := (rows + uint64(to) - 1) / uint64(to) * uint64(to)
+		if padded == rows {
+			continue
+		}
+
+		shape := slices.Clone(t.Shape)
+		shape[0] = padded
+
+		ts[i].Shape = shape
+		ts[i].WriterTo = padWriterTo{t.WriterTo, int64((padded - rows) * (t.Size() / rows))}
+	}
+
+	return ts
+}
+
+// padWriterTo writes the tensor followed by pad zero bytes.
+type padWriterTo struct {
+	io.WriterTo
+	pad int64
+}
+
+func (p padWriterTo) WriteTo(w io.Writer) (int64, error) {
+	n, err := p.WriterTo.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+
+	nn, err := io.CopyN(w, zeros{}, p.pad)
+	return n + nn, err
+}
+
+// zeros is an endless reader of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+// applyOverrides sets each override in kv, coercing the value to the type of
+// the existing entry. Keys that aren't already present are added with a
+// warning, typed by kvType.
+func applyOverrides(kv llm.KV, overrides map[string]any) error {
+	for k, v := range overrides {
+		existing, ok := kv[k]
+		if !ok {
+			slog.Warn("overriding unknown metadata key", "key", k)
+			existing = kvType(v)
+		}
+
+		coerced, err := coerceKV(existing, v)
+		if err != nil {
+			return fmt.Errorf("override %s: %w", k, err)
+		}
+
+		kv[k] = coerced
+	}
+
+	return nil
+}
+
+// kvType returns a zero value of the GGUF type to store v as when there's
+// no existing entry to match. Integers use the smallest of uint32, uint64,
+// int32 and int64 that holds them and other numbers are float32.
+func kvType(v any) any {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		if n, err := toUint64(v); err == nil {
+			if n <= math.MaxUint32 {
+				return uint32(0)
+			}
+
+			return uint64(0)
+		}
+
+		if n, err := toInt64(v); err == nil && n >= math.MinInt32 {
+			return int32(0)
+		}
+
+		return int64(0)
+	case float32, float64:
+		return float32(0)
+	}
+
+	return v
+}
+
+// coerceKV converts v to the GGUF value type of want, failing if it's out of
+// that type's range.
+func coerceKV(want, v any) (any, error) {
+	switch want.(type) {
+	case uint8:
+		return coerceUint[uint8](v)
+	case uint16:
+		return coerceUint[uint16](v)
+	case uint32:
+		return coerceUint[uint32](v)
+	case uint64:
+		return coerceUint[uint64](v)
+	case int8:
+		return coerceInt[int8](v)
+	case int16:
+		return coerceInt[int16](v)
+	case int32:
+		return coerceInt[int32](v)
+	case int64:
+		return coerceInt[int64](v)
+	case float32:
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+
+		return float32(f), nil
+	case float64:
+		return toFloat64(v)
+	case bool:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case string:
+		if v, ok := v.(string); ok {
+			return v, nil
+		}
+
+		return fmt.Sprint(v), nil
+	case []string, []int32, []uint32, []float32, []bool:
+		if reflect.TypeOf(want) == reflect.TypeOf(v) {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot use %T as %T", v, want)
+}
+
+func coerceUint[T uint8 | uint16 | uint32 | uint64](v any) (any, error) {
+	n, err := toUint64(v)
+	if err != nil || uint64(T(n)) != n {
+		return nil, fmt.Errorf("%v is not a valid %T", v, T(0))
+	}
+
+	return T(n), nil
+}
+
+func coerceInt[T int8 | int16 | int32 | int64](v any) (any, error) {
+	n, err := toInt64(v)
+	if err != nil || int64(T(n)) != n {
+		return nil, fmt.Errorf("%v is not a valid %T", v, T(0))
+	}
+
+	return T(n), nil
+}
+
+// toUint64 converts v to a uint64 without losing precision, failing for
+// negative or fractional values.
+func toUint64(v any) (uint64, error) {
+	switch v := v.(type) {
+	case uint:
+		return uint64(v), nil
+	case uint8:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case string:
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+
+	if n, err := toInt64(v); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("%v is negative", v)
+		}
+
+		return uint64(n), nil
+	}
+
+	f, err := toFloat64(v)
+	if err != nil {
+		return 0, err
+	}
+
+	if f < 0 || f >= math.MaxUint64 || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%v is not a valid uint64", v)
+	}
+
+	return uint64(f), nil
+}
+
+// toInt64 converts v to an int64 without losing precision, failing for
+// fractional values.
+func toInt64(v any) (int64, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint, uint8, uint16, uint32, uint64:
+		n, err := toUint64(v)
+		if err != nil || n > math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not a valid int64", v)
+		}
+
+		return int64(n), nil
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+
+	f, err := toFloat64(v)
+	if err != nil {
+		return 0, err
+	}
+
+	if f < math.MinInt64 || f >= math.MaxInt64 || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%v is not a valid int64", v)
+	}
+
+	return int64(f), nil
+}
+
+func toFloat64(v any) (float64, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("%T is not a number", v)
+	}
+}
+
 func GetModelFormat(dirname string) (ModelFormat, error) {
 	files, err := filepath.Glob(filepath.Join(dirname, "*"))
 	if err != nil {
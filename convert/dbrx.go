@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type ffnConfig struct {
+	HiddenSize int `json:"ffn_hidden_size"`
+	Experts    int `json:"moe_num_experts"`
+	ExpertsTop int `json:"moe_top_k"`
+}
+
+type DBRXModel struct {
+	ModelData
+}
+
+func (m *DBRXModel) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	experts, ffn, embd := uint64(m.Params.FFNConfig.Experts), uint64(m.Params.FFNConfig.HiddenSize), uint64(m.Params.ModelDim)
+	for _, l := range t {
+		switch {
+		case strings.HasSuffix(l.Name, "ffn_gate_exps.weight"), strings.HasSuffix(l.Name, "ffn_up_exps.weight"):
+			// w1 and v1 already hold each expert's rows in turn so only
+			// the shape changes
+			if err := m.checkExperts(l); err != nil {
+				return err
+			}
+
+			l.Shape = []uint64{experts, ffn, embd}
+		case strings.HasSuffix(l.Name, "ffn_down_exps.weight"):
+			// w2 is stored like w1, transposed, so each expert needs
+			// transposing back
+			if err := m.checkExperts(l); err != nil {
+				return err
+			}
+
+			l.Shape = []uint64{experts, embd, ffn}
+
+			wt := l.WriterTo.(safetensorWriterTo)
+			wt.repacker = func(_ string, data []float32, _ []uint64) ([]float32, error) {
+				f32s := make([]float32, len(data))
+				for e := range experts {
+					expert := data[e*ffn*embd : (e+1)*ffn*embd]
+					for i := range ffn {
+						for j := range embd {
+							f32s[e*ffn*embd+j*ffn+i] = expert[i*embd+j]
+						}
+					}
+				}
+
+				return f32s, nil
+			}
+			l.WriterTo = wt
+		}
+
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	return nil
+}
+
+// checkExperts reports an error if the fused expert tensor t doesn't hold
+// ffn_hidden_size rows of d_model for each expert.
+func (m *DBRXModel) checkExperts(t llm.Tensor) error {
+	cfg := m.Params.FFNConfig
+	if len(t.Shape) != 2 || t.Shape[0] != uint64(cfg.Experts*cfg.HiddenSize) || t.Shape[1] != uint64(m.Params.ModelDim) {
+		return fmt.Errorf("%s: shape %v doesn't match %d experts of %dx%d", t.Name, t.Shape, cfg.Experts, cfg.HiddenSize, m.Params.ModelDim)
+	}
+
+	return nil
+}
+
+func (m *DBRXModel) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *DBRXModel) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":              "dbrx",
+		"general.name":                      m.Name,
+		"dbrx.context_length":               uint32(m.Params.MaxSeqLen),
+		"dbrx.embedding_length":             uint32(m.Params.ModelDim),
+		"dbrx.block_count":                  uint32(m.Params.ModelLayers),
+		"dbrx.feed_forward_length":          uint32(m.Params.FFNConfig.HiddenSize),
+		"dbrx.attention.head_count":         uint32(m.Params.ModelHeads),
+		"dbrx.attention.head_count_kv":      uint32(cmp.Or(m.Params.AttnConfig.KVHeads, m.Params.ModelHeads)),
+		"dbrx.attention.layer_norm_epsilon": float32(1e-5),
+		"dbrx.rope.freq_base":               float32(cmp.Or(m.Params.AttnConfig.RopeTheta, 10000)),
+		"dbrx.expert_count":                 uint32(m.Params.FFNConfig.Experts),
+		"dbrx.expert_used_count":            uint32(m.Params.FFNConfig.ExpertsTop),
+		"tokenizer.ggml.model":              "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id": uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id": uint32(m.Params.EoSTokenID),
+	}
+
+	if clip := m.Params.AttnConfig.ClipQKV; clip != nil {
+		kv["dbrx.attention.clamp_kqv"] = float32(*clip)
+	}
+
+	return m.writeGGUF(ws, kv)
+}
@@ -0,0 +1,139 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestConvertDBRX(t *testing.T) {
+	const experts, ffn, embd = 2, 3, 4
+
+	// element j of row i of expert e is e*100 + i*10 + j
+	w2 := make([]float32, experts*ffn*embd)
+	for i := range w2 {
+		e, r, c := i/(ffn*embd), i/embd%ffn, i%embd
+		w2[i] = float32(e*100 + r*10 + c)
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures": []string{"DbrxForCausalLM"},
+		"d_model":       embd,
+		"n_heads":       2,
+		"n_layers":      1,
+		"max_seq_len":   2048,
+		"attn_config": map[string]any{
+			"clip_qkv":   8,
+			"kv_n_heads": 1,
+			"rope_theta": 500000,
+		},
+		"ffn_config": map[string]any{
+			"ffn_hidden_size": ffn,
+			"moe_num_experts": experts,
+			"moe_top_k":       1,
+		},
+	})
+
+	writeBPETokenizer(t, dir)
+
+	writeSafetensors(t, dir,
+		safetensor{name: "transformer.wte.weight", shape: []uint64{4, embd}},
+		safetensor{name: "transformer.blocks.0.norm_attn_norm.norm_1.weight", shape: []uint64{embd}},
+		safetensor{name: "transformer.blocks.0.norm_attn_norm.attn.Wqkv.weight", shape: []uint64{8, embd}},
+		safetensor{name: "transformer.blocks.0.norm_attn_norm.attn.out_proj.weight", shape: []uint64{embd, embd}},
+		safetensor{name: "transformer.blocks.0.norm_attn_norm.norm_2.weight", shape: []uint64{embd}},
+		safetensor{name: "transformer.blocks.0.ffn.router.layer.weight", shape: []uint64{experts, embd}},
+		safetensor{name: "transformer.blocks.0.ffn.experts.mlp.w1", shape: []uint64{experts * ffn, embd}},
+		safetensor{name: "transformer.blocks.0.ffn.experts.mlp.v1", shape: []uint64{experts * ffn, embd}},
+		safetensor{name: "transformer.blocks.0.ffn.experts.mlp.w2", shape: []uint64{experts * ffn, embd}, data: w2},
+		safetensor{name: "transformer.norm_f.weight", shape: []uint64{embd}},
+		safetensor{name: "lm_head.weight", shape: []uint64{4, embd}},
+	)
+
+	kv, tensors := convertDir(t, dir)
+
+	for k, v := range map[string]any{
+		"general.architecture":         "dbrx",
+		"dbrx.embedding_length":        uint32(embd),
+		"dbrx.feed_forward_length":     uint32(ffn),
+		"dbrx.attention.head_count":    uint32(2),
+		"dbrx.attention.head_count_kv": uint32(1),
+		"dbrx.attention.clamp_kqv":     float32(8),
+		"dbrx.rope.freq_base":          float32(500000),
+		"dbrx.expert_count":            uint32(experts),
+		"dbrx.expert_used_count":       uint32(1),
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	// decoded shapes are in ggml order
+	for name, shape := range map[string][]uint64{
+		"blk.0.ffn_gate_inp.weight":  {embd, experts, 1, 1},
+		"blk.0.ffn_gate_exps.weight": {embd, ffn, experts, 1},
+		"blk.0.ffn_up_exps.weight":   {embd, ffn, experts, 1},
+		"blk.0.ffn_down_exps.weight": {ffn, embd, experts, 1},
+		"blk.0.attn_qkv.weight":      {embd, 8, 1, 1},
+	} {
+		i := slices.IndexFunc(tensors, func(t *llm.Tensor) bool { return t.Name == name })
+		if i < 0 {
+			t.Errorf("missing tensor %s", name)
+			continue
+		}
+
+		if got := tensors[i].Shape; !slices.Equal(got, shape) {
+			t.Errorf("%s: expected shape %v, got %v", name, shape, got)
+		}
+	}
+
+	t.Run("w2", func(t *testing.T) {
+		mf, err := GetModelFormat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params, err := mf.GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.OutputType = "F32"
+
+		arch, err := mf.GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*DBRXModel)
+		i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == "blk.0.ffn_down_exps.weight" })
+		if i < 0 {
+			t.Fatal("missing blk.0.ffn_down_exps.weight")
+		}
+
+		var b bytes.Buffer
+		if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]float32, len(w2))
+		if err := binary.Read(&b, binary.LittleEndian, got); err != nil {
+			t.Fatal(err)
+		}
+
+		// each expert is transposed to embd rows of ffn
+		for i, f := range got {
+			e, r, c := i/(ffn*embd), i/ffn%embd, i%ffn
+			if want := float32(e*100 + c*10 + r); f != want {
+				t.Fatalf("expected %v at %d, got %v", want, i, f)
+			}
+		}
+	})
+}
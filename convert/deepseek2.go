@@ -0,0 +1,159 @@
+package convert
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// ropeScaling is the rope_scaling of a config, as used by deepseek2 and
+// gemma3. Newer configs name the type rope_type.
+type ropeScaling struct {
+	Type                          string  `json:"type"`
+	RopeType                      string  `json:"rope_type"`
+	Factor                        float64 `json:"factor"`
+	OriginalMaxPositionEmbeddings int     `json:"original_max_position_embeddings"`
+	MScaleAllDim                  float64 `json:"mscale_all_dim"`
+}
+
+type Deepseek2Model struct {
+	ModelData
+}
+
+func (m *Deepseek2Model) GetTensors() error {
+	// deepseek2 permutes the decoupled rope dimensions of q and k into
+	// halves before rotating them, which is the same as rotating
+	// interleaved pairs, so like the runner nothing needs repacking
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range t {
+		if err := m.checkMLA(l); err != nil {
+			return err
+		}
+	}
+
+	// routed experts are stored one tensor per expert and stacked into a
+	// single tensor per layer. The shared experts are a single feed
+	// forward network which is written as is
+	ts, err := stackExperts("deepseek2", t, m.Params.RoutedExperts)
+	if err != nil {
+		return err
+	}
+
+	m.Tensors = append(m.Tensors, ts...)
+	return nil
+}
+
+// checkMLA reports an error if t is one of the multi-head latent attention
+// projections and its shape doesn't match the config. Keys and values are
+// compressed into a latent of kv_lora_rank, which attn_kv_a_mqa projects to
+// along with the decoupled rope part of the key shared by all heads.
+// attn_kv_b expands the latent into each head's key, without rope, and
+// value. Queries are compressed the same way, into q_lora_rank, except in
+// the smaller models which project them directly.
+func (m *Deepseek2Model) checkMLA(t llm.Tensor) error {
+	p := m.Params
+	hidden, heads := uint64(p.HiddenSize), uint64(p.AttentionHeads)
+	nope, rope, v := uint64(p.QKNopeHeadDim), uint64(p.QKRopeHeadDim), uint64(p.VHeadDim)
+
+	var want []uint64
+	switch {
+	case strings.HasSuffix(t.Name, "attn_kv_a_mqa.weight"):
+		want = []uint64{uint64(p.KVLoRARank) + rope, hidden}
+	case strings.HasSuffix(t.Name, "attn_kv_b.weight"):
+		want = []uint64{heads * (nope + v), uint64(p.KVLoRARank)}
+	case strings.HasSuffix(t.Name, "attn_q_a.weight"):
+		want = []uint64{uint64(p.QLoRARank), hidden}
+	case strings.HasSuffix(t.Name, "attn_q_b.weight"):
+		want = []uint64{heads * (nope + rope), uint64(p.QLoRARank)}
+	case strings.HasSuffix(t.Name, "attn_q.weight"):
+		want = []uint64{heads * (nope + rope), hidden}
+	default:
+		return nil
+	}
+
+	if !slices.Equal(t.Shape, want) {
+		return fmt.Errorf("deepseek2: %s has shape %v, expected %v", t.Name, t.Shape, want)
+	}
+
+	return nil
+}
+
+func (m *Deepseek2Model) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *Deepseek2Model) WriteGGUF(ws io.WriteSeeker) error {
+	p := m.Params
+
+	kv := llm.KV{
+		"general.architecture":                       "deepseek2",
+		"general.name":                               m.Name,
+		"deepseek2.context_length":                   uint32(p.ContextSize),
+		"deepseek2.embedding_length":                 uint32(p.HiddenSize),
+		"deepseek2.block_count":                      uint32(p.HiddenLayers),
+		"deepseek2.feed_forward_length":              uint32(p.IntermediateSize),
+		"deepseek2.leading_dense_block_count":        uint32(p.FirstKDenseReplace),
+		"deepseek2.rope.freq_base":                   p.ropeFreqBase(),
+		"deepseek2.rope.dimension_count":             uint32(p.QKRopeHeadDim),
+		"deepseek2.attention.head_count":             uint32(p.AttentionHeads),
+		"deepseek2.attention.head_count_kv":          uint32(p.kvHeads()),
+		"deepseek2.attention.key_length":             uint32(p.QKNopeHeadDim + p.QKRopeHeadDim),
+		"deepseek2.attention.value_length":           uint32(p.VHeadDim),
+		"deepseek2.attention.kv_lora_rank":           uint32(p.KVLoRARank),
+		"deepseek2.attention.layer_norm_rms_epsilon": float32(p.NormEPS),
+
+		"deepseek2.expert_count":               uint32(p.RoutedExperts),
+		"deepseek2.expert_shared_count":        uint32(p.SharedExperts),
+		"deepseek2.expert_used_count":          uint32(p.ExpertsUsed),
+		"deepseek2.expert_feed_forward_length": uint32(p.MoEIntermediateSize),
+		"deepseek2.expert_weights_scale":       float32(p.RoutedScalingFactor),
+
+		// the pretokenizer belongs to the architecture so it isn't
+		// detected from tokenizer.json
+		"tokenizer.ggml.model": "gpt2",
+		"tokenizer.ggml.pre":   "deepseek-llm",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id":  uint32(p.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":  uint32(p.EoSTokenID),
+		"tokenizer.ggml.add_bos_token": true,
+	}
+
+	// the smaller models project queries directly, without compressing
+	// them
+	if p.QLoRARank > 0 {
+		kv["deepseek2.attention.q_lora_rank"] = uint32(p.QLoRARank)
+	}
+
+	if s := p.RopeScaling; s != nil && s.Type == "yarn" {
+		kv["deepseek2.rope.scaling.type"] = "yarn"
+		kv["deepseek2.rope.scaling.factor"] = float32(s.Factor)
+		kv["deepseek2.rope.scaling.original_context_length"] = uint32(s.OriginalMaxPositionEmbeddings)
+		kv["deepseek2.rope.scaling.yarn_log_multiplier"] = float32(0.1 * s.MScaleAllDim)
+	}
+
+	return m.writeGGUF(ws, kv)
+}
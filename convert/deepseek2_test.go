@@ -0,0 +1,199 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func testDeepseek2Dir(t *testing.T, config map[string]any) string {
+	t.Helper()
+
+	const (
+		hidden  = 8
+		heads   = 2
+		qRank   = 4
+		kvRank  = 6
+		nope    = 2
+		rope    = 2
+		vDim    = 3
+		experts = 3
+		moeFFN  = 2
+	)
+
+	cfg := map[string]any{
+		"architectures":           []string{"DeepseekV2ForCausalLM"},
+		"auto_map":                map[string]any{"AutoModelForCausalLM": "modeling_deepseek.DeepseekV2ForCausalLM"},
+		"hidden_size":             hidden,
+		"intermediate_size":       16,
+		"moe_intermediate_size":   moeFFN,
+		"num_hidden_layers":       2,
+		"num_attention_heads":     heads,
+		"num_key_value_heads":     heads,
+		"first_k_dense_replace":   1,
+		"n_routed_experts":        experts,
+		"n_shared_experts":        2,
+		"num_experts_per_tok":     2,
+		"routed_scaling_factor":   16,
+		"q_lora_rank":             qRank,
+		"kv_lora_rank":            kvRank,
+		"qk_nope_head_dim":        nope,
+		"qk_rope_head_dim":        rope,
+		"v_head_dim":              vDim,
+		"max_position_embeddings": 163840,
+		"rms_norm_eps":            1e-6,
+		"rope_theta":              10000,
+		"rope_scaling": map[string]any{
+			"type":                             "yarn",
+			"factor":                           40,
+			"original_max_position_embeddings": 4096,
+			"mscale":                           0.707,
+			"mscale_all_dim":                   0.707,
+		},
+	}
+	for k, v := range config {
+		cfg[k] = v
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", cfg)
+	writeBPETokenizer(t, dir)
+
+	ts := []safetensor{
+		{name: "model.embed_tokens.weight", shape: []uint64{4, hidden}},
+		{name: "model.norm.weight", shape: []uint64{hidden}},
+		{name: "lm_head.weight", shape: []uint64{4, hidden}},
+	}
+
+	for i := range 2 {
+		prefix := fmt.Sprintf("model.layers.%d.", i)
+		ts = append(ts,
+			safetensor{name: prefix + "input_layernorm.weight", shape: []uint64{hidden}},
+			safetensor{name: prefix + "self_attn.q_a_proj.weight", shape: []uint64{qRank, hidden}},
+			safetensor{name: prefix + "self_attn.q_a_layernorm.weight", shape: []uint64{qRank}},
+			safetensor{name: prefix + "self_attn.q_b_proj.weight", shape: []uint64{heads * (nope + rope), qRank}},
+			safetensor{name: prefix + "self_attn.kv_a_proj_with_mqa.weight", shape: []uint64{kvRank + rope, hidden}},
+			safetensor{name: prefix + "self_attn.kv_a_layernorm.weight", shape: []uint64{kvRank}},
+			safetensor{name: prefix + "self_attn.kv_b_proj.weight", shape: []uint64{heads * (nope + vDim), kvRank}},
+			safetensor{name: prefix + "self_attn.o_proj.weight", shape: []uint64{hidden, heads * vDim}},
+			safetensor{name: prefix + "post_attention_layernorm.weight", shape: []uint64{hidden}},
+		)
+	}
+
+	// the first layer is dense, the second uses experts
+	ts = append(ts,
+		safetensor{name: "model.layers.0.mlp.gate_proj.weight", shape: []uint64{16, hidden}},
+		safetensor{name: "model.layers.0.mlp.up_proj.weight", shape: []uint64{16, hidden}},
+		safetensor{name: "model.layers.0.mlp.down_proj.weight", shape: []uint64{hidden, 16}},
+		safetensor{name: "model.layers.1.mlp.gate.weight", shape: []uint64{experts, hidden}},
+		safetensor{name: "model.layers.1.mlp.shared_experts.gate_proj.weight", shape: []uint64{2 * moeFFN, hidden}},
+		safetensor{name: "model.layers.1.mlp.shared_experts.up_proj.weight", shape: []uint64{2 * moeFFN, hidden}},
+		safetensor{name: "model.layers.1.mlp.shared_experts.down_proj.weight", shape: []uint64{hidden, 2 * moeFFN}},
+	)
+
+	for e := range experts {
+		prefix := fmt.Sprintf("model.layers.1.mlp.experts.%d.", e)
+		ts = append(ts,
+			safetensor{name: prefix + "gate_proj.weight", shape: []uint64{moeFFN, hidden}},
+			safetensor{name: prefix + "up_proj.weight", shape: []uint64{moeFFN, hidden}},
+			safetensor{name: prefix + "down_proj.weight", shape: []uint64{hidden, moeFFN}},
+		)
+	}
+
+	writeSafetensors(t, dir, ts...)
+	return dir
+}
+
+func TestConvertDeepseek2(t *testing.T) {
+	kv, tensors := convertDir(t, testDeepseek2Dir(t, nil))
+
+	for k, v := range map[string]any{
+		"general.architecture":                           "deepseek2",
+		"deepseek2.context_length":                       uint32(163840),
+		"deepseek2.embedding_length":                     uint32(8),
+		"deepseek2.block_count":                          uint32(2),
+		"deepseek2.feed_forward_length":                  uint32(16),
+		"deepseek2.leading_dense_block_count":            uint32(1),
+		"deepseek2.attention.head_count":                 uint32(2),
+		"deepseek2.attention.head_count_kv":              uint32(2),
+		"deepseek2.attention.q_lora_rank":                uint32(4),
+		"deepseek2.attention.kv_lora_rank":               uint32(6),
+		"deepseek2.attention.key_length":                 uint32(4),
+		"deepseek2.attention.value_length":               uint32(3),
+		"deepseek2.rope.dimension_count":                 uint32(2),
+		"deepseek2.expert_count":                         uint32(3),
+		"deepseek2.expert_shared_count":                  uint32(2),
+		"deepseek2.expert_used_count":                    uint32(2),
+		"deepseek2.expert_feed_forward_length":           uint32(2),
+		"deepseek2.expert_weights_scale":                 float32(16),
+		"deepseek2.rope.scaling.type":                    "yarn",
+		"deepseek2.rope.scaling.factor":                  float32(40),
+		"deepseek2.rope.scaling.original_context_length": uint32(4096),
+		"tokenizer.ggml.pre":                             "deepseek-llm",
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	shapes := make(map[string][]uint64)
+	for _, t := range tensors {
+		shapes[t.Name] = t.Shape
+	}
+
+	// decoded shapes are reversed and padded to four dimensions
+	for name, shape := range map[string][]uint64{
+		"blk.0.attn_q_a.weight":       {8, 4},
+		"blk.0.attn_q_a_norm.weight":  {4},
+		"blk.0.attn_q_b.weight":       {4, 8},
+		"blk.0.attn_kv_a_mqa.weight":  {8, 8},
+		"blk.0.attn_kv_a_norm.weight": {6},
+		"blk.0.attn_kv_b.weight":      {6, 10},
+		"blk.0.attn_output.weight":    {6, 8},
+		"blk.0.ffn_gate.weight":       {8, 16},
+		"blk.1.ffn_gate_inp.weight":   {8, 3},
+		"blk.1.ffn_gate_exps.weight":  {8, 2, 3},
+		"blk.1.ffn_down_exps.weight":  {2, 8, 3},
+		"blk.1.ffn_gate_shexp.weight": {8, 4},
+		"blk.1.ffn_down_shexp.weight": {4, 8},
+	} {
+		if got, ok := shapes[name]; !ok {
+			t.Errorf("missing tensor %s", name)
+		} else if !slices.Equal(got[:len(shape)], shape) {
+			t.Errorf("expected %s shape %v, got %v", name, shape, got[:len(shape)])
+		}
+	}
+
+	t.Run("without q lora", func(t *testing.T) {
+		dir := testDeepseek2Dir(t, map[string]any{"q_lora_rank": nil})
+
+		// the smaller models project queries directly
+		writeSafetensors(t, dir,
+			safetensor{name: "model.embed_tokens.weight", shape: []uint64{4, 8}},
+			safetensor{name: "model.layers.0.self_attn.q_proj.weight", shape: []uint64{8, 8}},
+		)
+
+		kv, _ := convertDir(t, dir)
+		if _, ok := kv["deepseek2.attention.q_lora_rank"]; ok {
+			t.Error("unexpected q_lora_rank without q lora")
+		}
+	})
+
+	t.Run("rank mismatch", func(t *testing.T) {
+		dir := testDeepseek2Dir(t, map[string]any{"kv_lora_rank": 4})
+
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err == nil {
+			t.Error("expected an error for latent projections not matching kv_lora_rank")
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package convert
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type FalconModel struct {
+	ModelData
+}
+
+func (m *FalconModel) heads() int {
+	return cmp.Or(m.Params.AttentionHeads, m.Params.NumHeads)
+}
+
+// kvHeads returns the number of key/value heads. Falcon-40B style checkpoints
+// group query heads, Falcon-7B style checkpoints share a single key/value head
+// between all query heads.
+func (m *FalconModel) kvHeads() int {
+	switch {
+	case m.Params.NewDecoderArchitecture:
+		return cmp.Or(m.Params.NumKVHeads, m.Params.NumHeadKV, m.heads())
+	case m.Params.MultiQuery:
+		return 1
+	default:
+		return m.heads()
+	}
+}
+
+func (m *FalconModel) GetTensors() error {
+	if m.Params.ParallelAttention != nil && !*m.Params.ParallelAttention {
+		return errors.New("falcon: sequential attention and mlp blocks are not supported")
+	}
+
+	if m.Params.Alibi {
+		return errors.New("falcon: alibi position embeddings are not supported")
+	}
+
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range t {
+		if strings.HasSuffix(l.Name, "attn_qkv.weight") {
+			wt := l.WriterTo.(safetensorWriterTo)
+			wt.repacker = m.Repack
+			l.WriterTo = wt
+		}
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	return nil
+}
+
+func (m *FalconModel) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+// Repack reorders the fused query_key_value projection. Falcon stores one
+// group per key/value head, each holding its query heads followed by a key
+// and a value head. The runner expects all query heads, then all key heads,
+// then all value heads.
+func (m *FalconModel) Repack(name string, data []float32, shape []uint64) ([]float32, error) {
+	heads, kvHeads := m.heads(), m.kvHeads()
+	if kvHeads == 0 || heads%kvHeads != 0 {
+		return nil, fmt.Errorf("%s: %d heads can't be grouped across %d key/value heads", name, heads, kvHeads)
+	}
+
+	rows := int(shape[0])
+	if rows%(heads+2*kvHeads) != 0 {
+		return nil, fmt.Errorf("%s: %d rows don't match %d heads and %d key/value heads", name, rows, heads, kvHeads)
+	}
+
+	cols := len(data) / rows
+	headDim := rows / (heads + 2*kvHeads)
+	group := heads/kvHeads + 2
+
+	rowsOf := func(g, start, n int) []float32 {
+		row := (g*group + start) * headDim
+		return data[row*cols : (row+n*headDim)*cols]
+	}
+
+	f32s := make([]float32, 0, len(data))
+	for g := range kvHeads {
+		f32s = append(f32s, rowsOf(g, 0, group-2)...)
+	}
+
+	for g := range kvHeads {
+		f32s = append(f32s, rowsOf(g, group-2, 1)...)
+	}
+
+	for g := range kvHeads {
+		f32s = append(f32s, rowsOf(g, group-1, 1)...)
+	}
+
+	return f32s, nil
+}
+
+func (m *FalconModel) WriteGGUF(ws io.WriteSeeker) error {
+	hiddenSize := m.Params.HiddenSize
+
+	kv := llm.KV{
+		"general.architecture":                "falcon",
+		"general.name":                        m.Name,
+		"falcon.context_length":               uint32(cmp.Or(m.Params.ContextSize, 2048)),
+		"falcon.embedding_length":             uint32(hiddenSize),
+		"falcon.feed_forward_length":          uint32(cmp.Or(m.Params.IntermediateSize, 4*hiddenSize)),
+		"falcon.block_count":                  uint32(cmp.Or(m.Params.HiddenLayers, m.Params.NumLayers)),
+		"falcon.attention.head_count":         uint32(m.heads()),
+		"falcon.attention.head_count_kv":      uint32(m.kvHeads()),
+		"falcon.attention.layer_norm_epsilon": float32(cmp.Or(m.Params.LayerNormEpsilon, m.Params.LayerNormEPS)),
+		"tokenizer.ggml.model":                "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id": uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id": uint32(m.Params.EoSTokenID),
+	}
+
+	return m.writeGGUF(ws, kv)
+}
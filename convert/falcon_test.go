@@ -0,0 +1,107 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestConvertFalcon(t *testing.T) {
+	for _, blocks := range []string{"h", "blocks"} {
+		t.Run(blocks, func(t *testing.T) {
+			dir := t.TempDir()
+			writeJSON(t, dir, "config.json", map[string]any{
+				"architectures":      []string{"RWForCausalLM"},
+				"hidden_size":        4,
+				"n_head":             2,
+				"n_layer":            1,
+				"multi_query":        true,
+				"parallel_attn":      true,
+				"layer_norm_epsilon": 1e-5,
+			})
+
+			writeBPETokenizer(t, dir)
+
+			prefix := fmt.Sprintf("transformer.%s.0.", blocks)
+			writeSafetensors(t, dir,
+				safetensor{name: "transformer.word_embeddings.weight", shape: []uint64{4, 4}},
+				safetensor{name: prefix + "input_layernorm.weight", shape: []uint64{4}},
+				safetensor{name: prefix + "input_layernorm.bias", shape: []uint64{4}},
+				safetensor{name: prefix + "self_attention.query_key_value.weight", shape: []uint64{8, 4}},
+				safetensor{name: prefix + "self_attention.dense.weight", shape: []uint64{4, 4}},
+				safetensor{name: prefix + "mlp.dense_h_to_4h.weight", shape: []uint64{16, 4}},
+				safetensor{name: prefix + "mlp.dense_4h_to_h.weight", shape: []uint64{4, 16}},
+				safetensor{name: "transformer.ln_f.weight", shape: []uint64{4}},
+				safetensor{name: "transformer.ln_f.bias", shape: []uint64{4}},
+				safetensor{name: "lm_head.weight", shape: []uint64{4, 4}},
+			)
+
+			kv, tensors := convertDir(t, dir)
+
+			expect := map[string]any{
+				"general.architecture":                "falcon",
+				"falcon.context_length":               uint32(2048),
+				"falcon.feed_forward_length":          uint32(16),
+				"falcon.block_count":                  uint32(1),
+				"falcon.attention.head_count":         uint32(2),
+				"falcon.attention.head_count_kv":      uint32(1),
+				"falcon.attention.layer_norm_epsilon": float32(1e-5),
+			}
+
+			for k, v := range expect {
+				if got := kv[k]; got != v {
+					t.Errorf("expected %s %v, got %v", k, v, got)
+				}
+			}
+
+			var names []string
+			for _, t := range tensors {
+				names = append(names, t.Name)
+			}
+
+			for _, name := range []string{"token_embd.weight", "blk.0.attn_norm.bias", "blk.0.attn_qkv.weight", "output_norm.bias", "output.weight"} {
+				if !slices.Contains(names, name) {
+					t.Errorf("expected tensor %s, got %v", name, names)
+				}
+			}
+		})
+	}
+}
+
+func TestFalconRepack(t *testing.T) {
+	cases := []struct {
+		name   string
+		params Params
+		data   []float32
+		expect []float32
+	}{
+		{
+			// a single group is already laid out as q, k, v
+			name:   "multi query",
+			params: Params{NumHeads: 2, MultiQuery: true},
+			data:   []float32{0, 1, 2, 3},
+			expect: []float32{0, 1, 2, 3},
+		},
+		{
+			// two groups of [q, q, k, v]
+			name:   "grouped query",
+			params: Params{NumHeads: 4, NumKVHeads: 2, NewDecoderArchitecture: true},
+			data:   []float32{0, 1, 2, 3, 4, 5, 6, 7},
+			expect: []float32{0, 1, 4, 5, 2, 6, 3, 7},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &FalconModel{ModelData{Params: &tt.params}}
+			got, err := m.Repack("blk.0.attn_qkv.weight", tt.data, []uint64{uint64(len(tt.data))})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.expect) {
+				t.Errorf("expected %v, got %v", tt.expect, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package convert
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -38,23 +39,48 @@ func addOnes(data []float32, vectorSize int) ([]float32, error) {
 	return f32s, nil
 }
 
+// GetTensors reads the tensors of a v1 Gemma model. Gemma 2 configs set
+// logit soft-capping and later generations add norms around the feed forward
+// network, neither of which the v1 architecture can represent, so they're
+// refused rather than silently converted without them.
 func (m *GemmaModel) GetTensors() error {
-	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if m.Params.FinalLogitSoftcap != nil || m.Params.AttnLogitSoftcap != nil {
+		return errors.New("gemma: logit soft-capping is not supported, the model is likely gemma2")
+	}
+
+	t, err := m.readTensors()
 	if err != nil {
 		return err
 	}
 
-	slog.Debug(fmt.Sprintf("Total tensors: %d", len(t)))
 	for _, l := range t {
+		if strings.HasSuffix(l.Name, "ffw_norm.weight") {
+			return fmt.Errorf("gemma: %s is not supported by the v1 architecture", l.Name)
+		}
+	}
+
+	m.Tensors = append(m.Tensors, t...)
+	return nil
+}
+
+// readTensors reads the model's tensors with gemma's norm weights, which are
+// stored offset by one, repacked.
+func (m *GemmaModel) readTensors() ([]llm.Tensor, error) {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug(fmt.Sprintf("Total tensors: %d", len(t)))
+	for i, l := range t {
 		if strings.HasSuffix(l.Name, "norm.weight") {
 			wt := l.WriterTo.(safetensorWriterTo)
 			wt.repacker = m.Repack
-			l.WriterTo = wt
+			t[i].WriterTo = wt
 		}
-		m.Tensors = append(m.Tensors, l)
 	}
 
-	return nil
+	return t, nil
 }
 
 func (m *GemmaModel) LoadVocab() error {
@@ -78,12 +104,12 @@ func (m *GemmaModel) WriteGGUF(ws io.WriteSeeker) error {
 		"gemma.embedding_length":                 uint32(m.Params.HiddenSize),
 		"gemma.block_count":                      uint32(m.Params.HiddenLayers),
 		"gemma.feed_forward_length":              uint32(m.Params.IntermediateSize),
+		"gemma.rope.freq_base":                   m.Params.ropeFreqBase(),
 		"gemma.attention.head_count":             uint32(m.Params.AttentionHeads),
-		"gemma.attention.head_count_kv":          uint32(m.Params.KeyValHeads),
+		"gemma.attention.head_count_kv":          uint32(m.Params.kvHeads()),
 		"gemma.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
-		"gemma.attention.key_length":             uint32(m.Params.HeadDimension),
-		"gemma.attention.value_length":           uint32(m.Params.HeadDimension),
-		"general.file_type":                      uint32(1),
+		"gemma.attention.key_length":             uint32(m.Params.headDim()),
+		"gemma.attention.value_length":           uint32(m.Params.headDim()),
 		"tokenizer.ggml.model":                   "llama",
 
 		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
@@ -98,5 +124,5 @@ func (m *GemmaModel) WriteGGUF(ws io.WriteSeeker) error {
 		"tokenizer.ggml.add_eos_token":    false,
 	}
 
-	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
+	return m.writeGGUF(ws, kv)
 }
@@ -0,0 +1,93 @@
+package convert
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// Gemma3Model converts the text only Gemma 3 models. Layers interleave local
+// sliding window attention with global attention, each with its own rope
+// base, and queries and keys are normalized per head.
+type Gemma3Model struct {
+	GemmaModel
+}
+
+// gemma3Norms renames the norms gemma's mapping gives v1 names. The norm
+// after attention is its own tensor, rather than the one before the feed
+// forward network, which gemma3 calls pre_feedforward_layernorm.
+var gemma3Norms = strings.NewReplacer(
+	".ffn_norm.weight", ".post_attention_norm.weight",
+	".pre_ffw_norm.weight", ".ffn_norm.weight",
+)
+
+func (m *Gemma3Model) GetTensors() error {
+	if m.Params.FinalLogitSoftcap != nil || m.Params.AttnLogitSoftcap != nil {
+		return errors.New("gemma3: logit soft-capping is not supported")
+	}
+
+	// the q and k norms are offset by one like gemma's other norms so
+	// they're repacked along with them
+	t, err := m.readTensors()
+	if err != nil {
+		return err
+	}
+
+	for _, l := range t {
+		l.Name = gemma3Norms.Replace(l.Name)
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	return nil
+}
+
+func (m *Gemma3Model) WriteGGUF(ws io.WriteSeeker) error {
+	pattern, err := m.Params.slidingWindowLayers("gemma3", 6)
+	if err != nil {
+		return err
+	}
+
+	kv := llm.KV{
+		"general.architecture":                    "gemma3",
+		"general.name":                            m.Name,
+		"gemma3.context_length":                   uint32(m.Params.ContextSize),
+		"gemma3.embedding_length":                 uint32(m.Params.HiddenSize),
+		"gemma3.block_count":                      uint32(m.Params.HiddenLayers),
+		"gemma3.feed_forward_length":              uint32(m.Params.IntermediateSize),
+		"gemma3.attention.head_count":             uint32(m.Params.AttentionHeads),
+		"gemma3.attention.head_count_kv":          uint32(m.Params.kvHeads()),
+		"gemma3.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
+		"gemma3.attention.key_length":             uint32(m.Params.headDim()),
+		"gemma3.attention.value_length":           uint32(m.Params.headDim()),
+
+		// local layers attend within the sliding window and rotate with
+		// their own, smaller, rope base
+		"gemma3.attention.sliding_window":         uint32(m.Params.SlidingWindow),
+		"gemma3.attention.sliding_window_pattern": pattern,
+		"gemma3.rope.freq_base":                   float32(cmp.Or(m.Params.RopeFrequencyBase, 1000000)),
+		"gemma3.rope.local.freq_base":             float32(cmp.Or(m.Params.RopeLocalBaseFreq, 10000)),
+
+		"tokenizer.ggml.model":      "llama",
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.scores":     m.Vocab.Scores,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+
+		"tokenizer.ggml.bos_token_id":     uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":     uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.padding_token_id": uint32(m.Params.PaddingTokenID),
+		"tokenizer.ggml.unknown_token_id": uint32(3),
+		"tokenizer.ggml.add_bos_token":    true,
+		"tokenizer.ggml.add_eos_token":    false,
+	}
+
+	// the larger models stretch the global layers' rope linearly
+	if s := m.Params.RopeScaling; s != nil && cmp.Or(s.RopeType, s.Type) == "linear" {
+		kv["gemma3.rope.scaling.type"] = "linear"
+		kv["gemma3.rope.scaling.factor"] = float32(s.Factor)
+	}
+
+	return m.writeGGUF(ws, kv)
+}
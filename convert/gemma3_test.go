@@ -0,0 +1,166 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func testGemma3Dir(t *testing.T, config map[string]any) string {
+	t.Helper()
+
+	cfg := map[string]any{
+		"architectures":           []string{"Gemma3ForCausalLM"},
+		"hidden_size":             4,
+		"intermediate_size":       8,
+		"num_hidden_layers":       4,
+		"num_attention_heads":     2,
+		"num_key_value_heads":     1,
+		"head_dim":                2,
+		"max_position_embeddings": 32768,
+		"rms_norm_eps":            1e-6,
+		"rope_theta":              1000000,
+		"rope_local_base_freq":    10000,
+		"sliding_window":          512,
+		"sliding_window_pattern":  2,
+		"rope_scaling":            map[string]any{"rope_type": "linear", "factor": 8},
+		"final_logit_softcapping": nil,
+		"attn_logit_softcapping":  nil,
+		"bos_token_id":            1,
+		"eos_token_id":            2,
+	}
+	for k, v := range config {
+		cfg[k] = v
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", cfg)
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+
+	ts := []safetensor{
+		{name: "model.embed_tokens.weight", shape: []uint64{6, 4}},
+		{name: "model.norm.weight", shape: []uint64{4}},
+	}
+
+	for i := range 4 {
+		prefix := fmt.Sprintf("model.layers.%d.", i)
+		ts = append(ts,
+			safetensor{name: prefix + "input_layernorm.weight", shape: []uint64{4}},
+			safetensor{name: prefix + "self_attn.q_proj.weight", shape: []uint64{4, 4}},
+			safetensor{name: prefix + "self_attn.k_proj.weight", shape: []uint64{2, 4}},
+			safetensor{name: prefix + "self_attn.v_proj.weight", shape: []uint64{2, 4}},
+			safetensor{name: prefix + "self_attn.o_proj.weight", shape: []uint64{4, 4}},
+			safetensor{name: prefix + "self_attn.q_norm.weight", shape: []uint64{2}},
+			safetensor{name: prefix + "self_attn.k_norm.weight", shape: []uint64{2}},
+			safetensor{name: prefix + "post_attention_layernorm.weight", shape: []uint64{4}},
+			safetensor{name: prefix + "pre_feedforward_layernorm.weight", shape: []uint64{4}},
+			safetensor{name: prefix + "post_feedforward_layernorm.weight", shape: []uint64{4}},
+			safetensor{name: prefix + "mlp.gate_proj.weight", shape: []uint64{8, 4}},
+			safetensor{name: prefix + "mlp.up_proj.weight", shape: []uint64{8, 4}},
+			safetensor{name: prefix + "mlp.down_proj.weight", shape: []uint64{4, 8}},
+		)
+	}
+
+	writeSafetensors(t, dir, ts...)
+	return dir
+}
+
+func TestConvertGemma3(t *testing.T) {
+	kv, tensors := convertDir(t, testGemma3Dir(t, nil))
+
+	for k, v := range map[string]any{
+		"general.architecture":            "gemma3",
+		"gemma3.context_length":           uint32(32768),
+		"gemma3.block_count":              uint32(4),
+		"gemma3.attention.head_count_kv":  uint32(1),
+		"gemma3.attention.key_length":     uint32(2),
+		"gemma3.attention.sliding_window": uint32(512),
+		"gemma3.rope.freq_base":           float32(1000000),
+		"gemma3.rope.local.freq_base":     float32(10000),
+		"gemma3.rope.scaling.type":        "linear",
+		"gemma3.rope.scaling.factor":      float32(8),
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	// every second layer is global
+	bts, err := json.Marshal(kv["gemma3.attention.sliding_window_pattern"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(bts) != `[true,false,true,false]` {
+		t.Errorf("expected sliding window pattern [true,false,true,false], got %s", bts)
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	for _, name := range []string{
+		"blk.1.attn_norm.weight",
+		"blk.1.attn_q_norm.weight",
+		"blk.1.attn_k_norm.weight",
+		"blk.1.post_attention_norm.weight",
+		"blk.1.ffn_norm.weight",
+		"blk.1.post_ffw_norm.weight",
+	} {
+		if !slices.Contains(names, name) {
+			t.Errorf("missing tensor %s", name)
+		}
+	}
+
+	if slices.Contains(names, "blk.1.pre_ffw_norm.weight") {
+		t.Error("unexpected tensor blk.1.pre_ffw_norm.weight")
+	}
+
+	t.Run("repacked norms", func(t *testing.T) {
+		dir := testGemma3Dir(t, nil)
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*Gemma3Model)
+		for _, name := range []string{"blk.0.attn_q_norm.weight", "blk.0.post_attention_norm.weight", "blk.0.ffn_norm.weight"} {
+			i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == name })
+			if i < 0 {
+				t.Fatalf("missing %s", name)
+			}
+
+			if wt := m.Tensors[i].WriterTo.(safetensorWriterTo); wt.repacker == nil {
+				t.Errorf("expected %s to be repacked", name)
+			}
+		}
+	})
+
+	t.Run("layer types", func(t *testing.T) {
+		kv, _ := convertDir(t, testGemma3Dir(t, map[string]any{
+			"layer_types": []string{"sliding_attention", "sliding_attention", "sliding_attention", "full_attention"},
+		}))
+
+		bts, err := json.Marshal(kv["gemma3.attention.sliding_window_pattern"])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(bts) != `[true,true,true,false]` {
+			t.Errorf("expected sliding window pattern [true,true,true,false], got %s", bts)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+)
+
+func testGemmaDir(t *testing.T, config map[string]any) string {
+	t.Helper()
+
+	cfg := map[string]any{
+		"architectures":           []string{"GemmaForCausalLM"},
+		"hidden_size":             4,
+		"intermediate_size":       8,
+		"num_hidden_layers":       1,
+		"num_attention_heads":     2,
+		"num_key_value_heads":     1,
+		"head_dim":                2,
+		"max_position_embeddings": 8192,
+		"rms_norm_eps":            1e-6,
+		"bos_token_id":            1,
+		"eos_token_id":            2,
+	}
+	for k, v := range config {
+		cfg[k] = v
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", cfg)
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+	writeSafetensors(t, dir,
+		safetensor{name: "model.embed_tokens.weight", shape: []uint64{6, 4}},
+		safetensor{name: "model.layers.0.input_layernorm.weight", shape: []uint64{4}},
+		safetensor{name: "model.layers.0.self_attn.q_proj.weight", shape: []uint64{4, 4}},
+		safetensor{name: "model.layers.0.self_attn.k_proj.weight", shape: []uint64{2, 4}},
+		safetensor{name: "model.layers.0.self_attn.v_proj.weight", shape: []uint64{2, 4}},
+		safetensor{name: "model.layers.0.self_attn.o_proj.weight", shape: []uint64{4, 4}},
+		safetensor{name: "model.layers.0.post_attention_layernorm.weight", shape: []uint64{4}},
+		safetensor{name: "model.layers.0.mlp.gate_proj.weight", shape: []uint64{8, 4}},
+		safetensor{name: "model.layers.0.mlp.up_proj.weight", shape: []uint64{8, 4}},
+		safetensor{name: "model.layers.0.mlp.down_proj.weight", shape: []uint64{4, 8}},
+		safetensor{name: "model.norm.weight", shape: []uint64{4}},
+	)
+
+	return dir
+}
+
+func TestConvertGemma(t *testing.T) {
+	kv, tensors := convertDir(t, testGemmaDir(t, nil))
+
+	for k, v := range map[string]any{
+		"general.architecture":          "gemma",
+		"gemma.context_length":          uint32(8192),
+		"gemma.embedding_length":        uint32(4),
+		"gemma.feed_forward_length":     uint32(8),
+		"gemma.attention.head_count":    uint32(2),
+		"gemma.attention.head_count_kv": uint32(1),
+		"gemma.attention.key_length":    uint32(2),
+		"gemma.attention.value_length":  uint32(2),
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	// v1 has no soft-capping or sliding window, which are gemma2's
+	for k := range kv {
+		if strings.Contains(k, "softcapping") || strings.Contains(k, "sliding_window") {
+			t.Errorf("unexpected gemma2 key %s", k)
+		}
+	}
+
+	for _, tensor := range tensors {
+		if strings.Contains(tensor.Name, "post_ffw_norm") || strings.Contains(tensor.Name, "post_attention_norm") {
+			t.Errorf("unexpected gemma2 tensor %s", tensor.Name)
+		}
+	}
+
+	t.Run("feed forward norms", func(t *testing.T) {
+		dir := testGemmaDir(t, nil)
+		writeSafetensors(t, dir,
+			safetensor{name: "model.embed_tokens.weight", shape: []uint64{6, 4}},
+			safetensor{name: "model.layers.0.post_feedforward_layernorm.weight", shape: []uint64{4}},
+		)
+
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err == nil {
+			t.Error("expected an error converting feed forward norms as gemma")
+		}
+	})
+
+	t.Run("gemma2", func(t *testing.T) {
+		dir := testGemmaDir(t, map[string]any{"final_logit_softcapping": 30.0, "attn_logit_softcapping": 50.0})
+
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err == nil {
+			t.Error("expected an error converting a soft-capped model as gemma")
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package convert
+
+import (
+	"cmp"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type GPT2Model struct {
+	ModelData
+}
+
+func (m *GPT2Model) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range t {
+		// gpt2's block projections are Conv1D modules which store their
+		// weights as in x out rather than out x in
+		if len(l.Shape) == 2 && slices.ContainsFunc([]string{"attn_qkv.weight", "attn_output.weight", "ffn_up.weight", "ffn_down.weight"}, func(suffix string) bool {
+			return strings.HasSuffix(l.Name, suffix)
+		}) {
+			rows, cols := l.Shape[0], l.Shape[1]
+			l.Shape = []uint64{cols, rows}
+
+			wt := l.WriterTo.(safetensorWriterTo)
+			wt.repacker = func(_ string, data []float32, _ []uint64) ([]float32, error) {
+				return transpose(data, rows, cols), nil
+			}
+			l.WriterTo = wt
+		}
+
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	return nil
+}
+
+// transpose returns the rows x cols matrix data as cols x rows.
+func transpose(data []float32, rows, cols uint64) []float32 {
+	f32s := make([]float32, len(data))
+	for i := range rows {
+		for j := range cols {
+			f32s[j*rows+i] = data[i*cols+j]
+		}
+	}
+
+	return f32s
+}
+
+func (m *GPT2Model) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *GPT2Model) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":              "gpt2",
+		"general.name":                      m.Name,
+		"gpt2.context_length":               uint32(m.Params.Positions),
+		"gpt2.embedding_length":             uint32(m.Params.EmbeddingSize),
+		"gpt2.block_count":                  uint32(m.Params.NumLayers),
+		"gpt2.feed_forward_length":          uint32(cmp.Or(m.Params.InnerSize, 4*m.Params.EmbeddingSize)),
+		"gpt2.attention.head_count":         uint32(m.Params.NumHeads),
+		"gpt2.attention.layer_norm_epsilon": float32(cmp.Or(m.Params.LayerNormEpsilon, 1e-5)),
+		"tokenizer.ggml.model":              "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id": uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id": uint32(m.Params.EoSTokenID),
+	}
+
+	return m.writeGGUF(ws, kv)
+}
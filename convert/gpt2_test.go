@@ -0,0 +1,136 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestConvertGPT2(t *testing.T) {
+	// c_attn is stored in x out, element j of row i is i*100 + j
+	cAttn := make([]float32, 4*12)
+	for i := range cAttn {
+		cAttn[i] = float32(i/12*100 + i%12)
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":      []string{"GPT2LMHeadModel"},
+		"n_embd":             4,
+		"n_head":             2,
+		"n_layer":            1,
+		"n_positions":        1024,
+		"n_ctx":              1024,
+		"layer_norm_epsilon": 1e-5,
+	})
+
+	writeBPETokenizer(t, dir)
+
+	writeSafetensors(t, dir,
+		safetensor{name: "wte.weight", shape: []uint64{4, 4}},
+		safetensor{name: "wpe.weight", shape: []uint64{8, 4}},
+		safetensor{name: "h.0.ln_1.weight", shape: []uint64{4}},
+		safetensor{name: "h.0.ln_1.bias", shape: []uint64{4}},
+		safetensor{name: "h.0.attn.bias", shape: []uint64{1, 1, 8, 8}},
+		safetensor{name: "h.0.attn.c_attn.weight", shape: []uint64{4, 12}, data: cAttn},
+		safetensor{name: "h.0.attn.c_attn.bias", shape: []uint64{12}},
+		safetensor{name: "h.0.attn.c_proj.weight", shape: []uint64{4, 4}},
+		safetensor{name: "h.0.attn.c_proj.bias", shape: []uint64{4}},
+		safetensor{name: "h.0.ln_2.weight", shape: []uint64{4}},
+		safetensor{name: "h.0.ln_2.bias", shape: []uint64{4}},
+		safetensor{name: "h.0.mlp.c_fc.weight", shape: []uint64{4, 16}},
+		safetensor{name: "h.0.mlp.c_fc.bias", shape: []uint64{16}},
+		safetensor{name: "h.0.mlp.c_proj.weight", shape: []uint64{16, 4}},
+		safetensor{name: "h.0.mlp.c_proj.bias", shape: []uint64{4}},
+		safetensor{name: "ln_f.weight", shape: []uint64{4}},
+		safetensor{name: "ln_f.bias", shape: []uint64{4}},
+	)
+
+	kv, tensors := convertDir(t, dir)
+
+	for k, v := range map[string]any{
+		"general.architecture":              "gpt2",
+		"gpt2.context_length":               uint32(1024),
+		"gpt2.embedding_length":             uint32(4),
+		"gpt2.block_count":                  uint32(1),
+		"gpt2.feed_forward_length":          uint32(16),
+		"gpt2.attention.head_count":         uint32(2),
+		"gpt2.attention.layer_norm_epsilon": float32(1e-5),
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	// decoded shapes are in ggml order, i.e. in x out
+	for name, shape := range map[string][]uint64{
+		"token_embd.weight":        {4, 4, 1, 1},
+		"position_embd.weight":     {4, 8, 1, 1},
+		"blk.0.attn_qkv.weight":    {4, 12, 1, 1},
+		"blk.0.attn_qkv.bias":      {12, 1, 1, 1},
+		"blk.0.attn_output.weight": {4, 4, 1, 1},
+		"blk.0.ffn_up.weight":      {4, 16, 1, 1},
+		"blk.0.ffn_down.weight":    {16, 4, 1, 1},
+		"output_norm.bias":         {4, 1, 1, 1},
+	} {
+		i := slices.IndexFunc(tensors, func(t *llm.Tensor) bool { return t.Name == name })
+		if i < 0 {
+			t.Errorf("missing tensor %s", name)
+			continue
+		}
+
+		if got := tensors[i].Shape; !slices.Equal(got, shape) {
+			t.Errorf("%s: expected shape %v, got %v", name, shape, got)
+		}
+	}
+
+	t.Run("c_attn", func(t *testing.T) {
+		mf, err := GetModelFormat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params, err := mf.GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.OutputType = "F32"
+
+		arch, err := mf.GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*GPT2Model)
+		i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == "blk.0.attn_qkv.weight" })
+		if i < 0 {
+			t.Fatal("missing blk.0.attn_qkv.weight")
+		}
+
+		var b bytes.Buffer
+		if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]float32, len(cAttn))
+		if err := binary.Read(&b, binary.LittleEndian, got); err != nil {
+			t.Fatal(err)
+		}
+
+		// written out x in so element i of row j is the source's element j
+		// of row i
+		for k, f := range got {
+			j, i := k/4, k%4
+			if want := float32(i*100 + j); f != want {
+				t.Fatalf("expected %v at %d, got %v", want, k, f)
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package convert
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type GPTNeoXModel struct {
+	ModelData
+}
+
+func (m *GPTNeoXModel) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range t {
+		if strings.Contains(l.Name, ".attn_qkv.") {
+			wt := l.WriterTo.(safetensorWriterTo)
+			wt.repacker = m.Repack
+			l.WriterTo = wt
+		}
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	return nil
+}
+
+func (m *GPTNeoXModel) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+// Repack reorders the fused query_key_value projection from per-head
+// interleaved [q, k, v] blocks into contiguous q, k and v blocks.
+func (m *GPTNeoXModel) Repack(name string, data []float32, shape []uint64) ([]float32, error) {
+	heads := m.Params.AttentionHeads
+	if heads == 0 || int(shape[0])%(3*heads) != 0 {
+		return nil, fmt.Errorf("%s: cannot split %d rows across %d heads", name, shape[0], heads)
+	}
+
+	rows := int(shape[0])
+	cols := len(data) / rows
+	headDim := rows / 3 / heads
+
+	f32s := make([]float32, 0, len(data))
+	for i := range 3 {
+		for h := range heads {
+			for d := range headDim {
+				row := (h*3+i)*headDim + d
+				f32s = append(f32s, data[row*cols:(row+1)*cols]...)
+			}
+		}
+	}
+
+	return f32s, nil
+}
+
+func (m *GPTNeoXModel) WriteGGUF(ws io.WriteSeeker) error {
+	parallelResidual := true
+	if m.Params.ParallelResidual != nil {
+		parallelResidual = *m.Params.ParallelResidual
+	}
+
+	rotaryPct := cmp.Or(m.Params.RotaryPct, 0.25)
+
+	kv := llm.KV{
+		"general.architecture":                 "gptneox",
+		"general.name":                         m.Name,
+		"gptneox.context_length":               uint32(m.Params.ContextSize),
+		"gptneox.embedding_length":             uint32(m.Params.HiddenSize),
+		"gptneox.block_count":                  uint32(m.Params.HiddenLayers),
+		"gptneox.feed_forward_length":          uint32(m.Params.IntermediateSize),
+		"gptneox.use_parallel_residual":        parallelResidual,
+		"gptneox.rope.dimension_count":         uint32(rotaryPct * float64(m.Params.headDim())),
+		"gptneox.attention.head_count":         uint32(m.Params.AttentionHeads),
+		"gptneox.attention.layer_norm_epsilon": float32(m.Params.LayerNormEPS),
+		"tokenizer.ggml.model":                 "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id": uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id": uint32(m.Params.EoSTokenID),
+	}
+
+	return m.writeGGUF(ws, kv)
+}
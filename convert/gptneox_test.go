@@ -0,0 +1,90 @@
+package convert
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConvertGPTNeoX(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":           []string{"GPTNeoXForCausalLM"},
+		"hidden_size":             4,
+		"intermediate_size":       16,
+		"num_hidden_layers":       1,
+		"num_attention_heads":     2,
+		"max_position_embeddings": 32,
+		"layer_norm_eps":          1e-5,
+		"rotary_pct":              0.5,
+		"use_parallel_residual":   false,
+		"eos_token_id":            1,
+	})
+
+	writeBPETokenizer(t, dir)
+
+	writeSafetensors(t, dir,
+		safetensor{name: "gpt_neox.embed_in.weight", shape: []uint64{4, 4}},
+		safetensor{name: "gpt_neox.layers.0.input_layernorm.weight", shape: []uint64{4}},
+		safetensor{name: "gpt_neox.layers.0.input_layernorm.bias", shape: []uint64{4}},
+		safetensor{name: "gpt_neox.layers.0.attention.query_key_value.weight", shape: []uint64{12, 4}},
+		safetensor{name: "gpt_neox.layers.0.attention.query_key_value.bias", shape: []uint64{12}},
+		safetensor{name: "gpt_neox.layers.0.attention.bias", shape: []uint64{1, 1, 32, 32}},
+		safetensor{name: "gpt_neox.layers.0.attention.dense.weight", shape: []uint64{4, 4}},
+		safetensor{name: "gpt_neox.layers.0.mlp.dense_h_to_4h.weight", shape: []uint64{16, 4}},
+		safetensor{name: "gpt_neox.layers.0.mlp.dense_4h_to_h.weight", shape: []uint64{4, 16}},
+		safetensor{name: "gpt_neox.final_layer_norm.weight", shape: []uint64{4}},
+		safetensor{name: "gpt_neox.final_layer_norm.bias", shape: []uint64{4}},
+		safetensor{name: "embed_out.weight", shape: []uint64{4, 4}},
+	)
+
+	kv, tensors := convertDir(t, dir)
+
+	expect := map[string]any{
+		"general.architecture":                 "gptneox",
+		"gptneox.use_parallel_residual":        false,
+		"gptneox.rope.dimension_count":         uint32(1),
+		"gptneox.attention.head_count":         uint32(2),
+		"gptneox.attention.layer_norm_epsilon": float32(1e-5),
+		"tokenizer.ggml.model":                 "gpt2",
+	}
+
+	for k, v := range expect {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	for _, name := range []string{"blk.0.attn_qkv.weight", "blk.0.attn_qkv.bias", "blk.0.attn_norm.bias", "output_norm.bias", "output.weight"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("expected tensor %s, got %v", name, names)
+		}
+	}
+
+	if slices.Contains(names, "blk.0.attention.bias") || len(names) != 11 {
+		t.Errorf("expected attention mask buffer to be skipped, got %v", names)
+	}
+}
+
+func TestGPTNeoXRepack(t *testing.T) {
+	m := &GPTNeoXModel{ModelData{Params: &Params{AttentionHeads: 2}}}
+
+	// two heads of size two, each laid out as [q, k, v]
+	data := []float32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	got, err := m.Repack("blk.0.attn_qkv.bias", data, []uint64{12})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []float32{0, 1, 6, 7, 2, 3, 8, 9, 4, 5, 10, 11}; !slices.Equal(got, expect) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	if _, err := m.Repack("blk.0.attn_qkv.bias", data[:10], []uint64{10}); err == nil {
+		t.Error("expected error for rows not divisible by heads")
+	}
+}
@@ -0,0 +1,134 @@
+package convert
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type InternLM2Model struct {
+	ModelData
+}
+
+func (m *InternLM2Model) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range t {
+		if strings.HasSuffix(l.Name, "attn_qkv.weight") {
+			qkv, err := m.splitQKV(l)
+			if err != nil {
+				return err
+			}
+
+			m.Tensors = append(m.Tensors, qkv...)
+			continue
+		}
+
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	return nil
+}
+
+// splitQKV splits the fused wqkv projection into attn_q, attn_k and attn_v.
+// InternLM2 stores one group per key/value head, each holding its query
+// heads followed by a key and a value head. Each split tensor reads the
+// whole projection and keeps its own rows.
+func (m *InternLM2Model) splitQKV(t llm.Tensor) ([]llm.Tensor, error) {
+	heads, kvHeads := m.Params.AttentionHeads, m.Params.kvHeads()
+	if kvHeads == 0 || heads%kvHeads != 0 {
+		return nil, fmt.Errorf("%s: %d heads can't be grouped across %d key/value heads", t.Name, heads, kvHeads)
+	}
+
+	rows := int(t.Shape[0])
+	if rows%(heads+2*kvHeads) != 0 {
+		return nil, fmt.Errorf("%s: %d rows don't match %d heads and %d key/value heads", t.Name, rows, heads, kvHeads)
+	}
+
+	headDim := rows / (heads + 2*kvHeads)
+	group := heads/kvHeads + 2
+	prefix := strings.TrimSuffix(t.Name, "attn_qkv.weight")
+
+	var ts []llm.Tensor
+	for i, part := range []struct {
+		name        string
+		start, size int
+	}{
+		{"attn_q", 0, group - 2},
+		{"attn_k", group - 2, 1},
+		{"attn_v", group - 1, 1},
+	} {
+		split := llm.Tensor{
+			Name:  prefix + part.name + ".weight",
+			Kind:  t.Kind,
+			Shape: []uint64{uint64(kvHeads * part.size * headDim), t.Shape[1]},
+		}
+
+		wt := t.WriterTo.(safetensorWriterTo)
+		wt.t = &split
+		wt.repacker = func(name string, data []float32, shape []uint64) ([]float32, error) {
+			cols := len(data) / rows
+
+			f32s := make([]float32, 0, int(shape[0])*cols)
+			for g := range kvHeads {
+				row := (g*group + part.start) * headDim
+				f32s = append(f32s, data[row*cols:(row+part.size*headDim)*cols]...)
+			}
+
+			// q and k need the same rotary permutation as llama
+			if i < 2 {
+				return llamaRepack(name, m.Params, f32s, shape)
+			}
+
+			return f32s, nil
+		}
+
+		split.WriterTo = wt
+		ts = append(ts, split)
+	}
+
+	return ts, nil
+}
+
+func (m *InternLM2Model) LoadVocab() error {
+	v, err := LoadSentencePieceTokens(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+	m.Vocab = v
+	return nil
+}
+
+func (m *InternLM2Model) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":                       "internlm2",
+		"general.name":                               m.Name,
+		"internlm2.context_length":                   uint32(m.Params.ContextSize),
+		"internlm2.embedding_length":                 uint32(m.Params.HiddenSize),
+		"internlm2.block_count":                      uint32(m.Params.HiddenLayers),
+		"internlm2.feed_forward_length":              uint32(m.Params.IntermediateSize),
+		"internlm2.rope.freq_base":                   m.Params.ropeFreqBase(),
+		"internlm2.rope.dimension_count":             uint32(m.Params.headDim()),
+		"internlm2.attention.head_count":             uint32(m.Params.AttentionHeads),
+		"internlm2.attention.head_count_kv":          uint32(m.Params.kvHeads()),
+		"internlm2.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
+		"tokenizer.ggml.model":                       "llama",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.scores":     m.Vocab.Scores,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+
+		"tokenizer.ggml.bos_token_id":     uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":     uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.padding_token_id": uint32(m.Params.PaddingTokenID),
+		"tokenizer.ggml.add_bos_token":    true,
+		"tokenizer.ggml.add_eos_token":    false,
+	}
+
+	return m.writeGGUF(ws, kv)
+}
@@ -0,0 +1,155 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestConvertInternLM2(t *testing.T) {
+	const (
+		heads   = 4
+		kvHeads = 2
+		headDim = 4
+		hidden  = heads * headDim
+		rows    = (heads + 2*kvHeads) * headDim
+	)
+
+	// every element of the fused projection holds its row number
+	qkv := make([]float32, rows*hidden)
+	for i := range qkv {
+		qkv[i] = float32(i / hidden)
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":           []string{"InternLM2ForCausalLM"},
+		"hidden_size":             hidden,
+		"intermediate_size":       32,
+		"num_attention_heads":     heads,
+		"num_key_value_heads":     kvHeads,
+		"num_hidden_layers":       1,
+		"max_position_embeddings": 32768,
+		"rms_norm_eps":            1e-5,
+		"rope_theta":              1000000,
+	})
+
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+
+	writeSafetensors(t, dir,
+		safetensor{name: "model.tok_embeddings.weight", shape: []uint64{6, hidden}},
+		safetensor{name: "model.layers.0.attention_norm.weight", shape: []uint64{hidden}},
+		safetensor{name: "model.layers.0.attention.wqkv.weight", shape: []uint64{rows, hidden}, data: qkv},
+		safetensor{name: "model.layers.0.attention.wo.weight", shape: []uint64{hidden, hidden}},
+		safetensor{name: "model.layers.0.ffn_norm.weight", shape: []uint64{hidden}},
+		safetensor{name: "model.layers.0.feed_forward.w1.weight", shape: []uint64{32, hidden}},
+		safetensor{name: "model.layers.0.feed_forward.w2.weight", shape: []uint64{hidden, 32}},
+		safetensor{name: "model.layers.0.feed_forward.w3.weight", shape: []uint64{32, hidden}},
+		safetensor{name: "model.norm.weight", shape: []uint64{hidden}},
+		safetensor{name: "output.weight", shape: []uint64{6, hidden}},
+	)
+
+	kv, tensors := convertDir(t, dir)
+
+	expect := map[string]any{
+		"general.architecture":                       "internlm2",
+		"internlm2.context_length":                   uint32(32768),
+		"internlm2.embedding_length":                 uint32(hidden),
+		"internlm2.feed_forward_length":              uint32(32),
+		"internlm2.block_count":                      uint32(1),
+		"internlm2.rope.freq_base":                   float32(1000000),
+		"internlm2.rope.dimension_count":             uint32(headDim),
+		"internlm2.attention.head_count":             uint32(heads),
+		"internlm2.attention.head_count_kv":          uint32(kvHeads),
+		"internlm2.attention.layer_norm_rms_epsilon": float32(1e-5),
+		"tokenizer.ggml.model":                       "llama",
+	}
+
+	for k, v := range expect {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	shapes := make(map[string][]uint64)
+	for _, t := range tensors {
+		shapes[t.Name] = t.Shape
+	}
+
+	if _, ok := shapes["blk.0.attn_qkv.weight"]; ok {
+		t.Error("unexpected fused blk.0.attn_qkv.weight")
+	}
+
+	// decoded shapes are reversed and padded to four dimensions
+	for name, want := range map[string][]uint64{
+		"blk.0.attn_q.weight": {hidden, heads * headDim},
+		"blk.0.attn_k.weight": {hidden, kvHeads * headDim},
+		"blk.0.attn_v.weight": {hidden, kvHeads * headDim},
+	} {
+		if got, ok := shapes[name]; !ok {
+			t.Errorf("missing tensor %s", name)
+		} else if !slices.Equal(got[:2], want) {
+			t.Errorf("expected %s shape %v, got %v", name, want, got[:2])
+		}
+	}
+
+	t.Run("split", func(t *testing.T) {
+		mf, err := GetModelFormat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params, err := mf.GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.OutputType = "F32"
+
+		arch, err := mf.GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		// with two groups of (q, q, k, v) heads of four rows each, the rotary
+		// permutation swaps the middle two rows of every q and k head
+		cases := map[string][]float32{
+			"blk.0.attn_q.weight": {0, 2, 1, 3, 4, 6, 5, 7, 16, 18, 17, 19, 20, 22, 21, 23},
+			"blk.0.attn_k.weight": {8, 10, 9, 11, 24, 26, 25, 27},
+			"blk.0.attn_v.weight": {12, 13, 14, 15, 28, 29, 30, 31},
+		}
+
+		m := arch.(*InternLM2Model)
+		for name, want := range cases {
+			i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == name })
+			if i < 0 {
+				t.Fatalf("missing %s", name)
+			}
+
+			var b bytes.Buffer
+			if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+				t.Fatal(err)
+			}
+
+			f32s := make([]float32, b.Len()/4)
+			if err := binary.Read(&b, binary.LittleEndian, f32s); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []float32
+			for row := range len(f32s) / hidden {
+				got = append(got, f32s[row*hidden])
+			}
+
+			if !slices.Equal(got, want) {
+				t.Errorf("expected %s rows %v, got %v", name, want, got)
+			}
+		}
+	})
+}
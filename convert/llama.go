@@ -1,7 +1,6 @@
 package convert
 
 import (
-	"cmp"
 	"errors"
 	"fmt"
 	"io"
@@ -55,7 +54,9 @@ func (m *LlamaModel) GetTensors() error {
 func (m *LlamaModel) LoadVocab() (err error) {
 	pre, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
 	if errors.Is(err, os.ErrNotExist) {
-		return nil
+		// older checkpoints only ship the sentencepiece model
+		m.Vocab, err = LoadSentencePieceTokens(m.Path, m.Params)
+		return err
 	} else if err != nil {
 		return err
 	}
@@ -80,13 +81,11 @@ func (m *LlamaModel) WriteGGUF(ws io.WriteSeeker) error {
 		"llama.embedding_length":                 uint32(m.Params.HiddenSize),
 		"llama.block_count":                      uint32(m.Params.HiddenLayers),
 		"llama.feed_forward_length":              uint32(m.Params.IntermediateSize),
-		"llama.rope.freq_base":                   float32(m.Params.RopeFrequencyBase),
-		"llama.rope.dimension_count":             uint32(m.Params.HiddenSize / m.Params.AttentionHeads),
+		"llama.rope.freq_base":                   m.Params.ropeFreqBase(),
+		"llama.rope.dimension_count":             uint32(m.Params.headDim()),
 		"llama.attention.head_count":             uint32(m.Params.AttentionHeads),
-		"llama.attention.head_count_kv":          uint32(m.Params.KeyValHeads),
+		"llama.attention.head_count_kv":          uint32(m.Params.kvHeads()),
 		"llama.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
-		"general.file_type":                      uint32(1),
-		"tokenizer.ggml.model":                   "gpt2",
 
 		"tokenizer.ggml.pre":        m.Params.PreTokenizer,
 		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
@@ -98,12 +97,14 @@ func (m *LlamaModel) WriteGGUF(ws io.WriteSeeker) error {
 	}
 
 	if len(m.Vocab.Merges) > 0 {
+		kv["tokenizer.ggml.model"] = "gpt2"
 		kv["tokenizer.ggml.merges"] = m.Vocab.Merges
 	} else {
+		kv["tokenizer.ggml.model"] = "llama"
 		kv["tokenizer.ggml.scores"] = m.Vocab.Scores
 	}
 
-	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
+	return m.writeGGUF(ws, kv)
 }
 
 func (m *LlamaModel) Repack(name string, data []float32, shape []uint64) ([]float32, error) {
@@ -123,7 +124,7 @@ func llamaRepack(name string, params *Params, data []float32, shape []uint64) ([
 	case strings.HasSuffix(name, "attn_q.weight"):
 		heads = params.AttentionHeads
 	case strings.HasSuffix(name, "attn_k.weight"):
-		heads = cmp.Or(params.KeyValHeads, params.AttentionHeads)
+		heads = params.kvHeads()
 	default:
 		return nil, fmt.Errorf("unknown tensor name: %s", name)
 	}
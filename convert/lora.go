@@ -0,0 +1,297 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// loraConfig is a PEFT adapter_config.json.
+type loraConfig struct {
+	Rank  int     `json:"r"`
+	Alpha float64 `json:"lora_alpha"`
+
+	// RankPattern and AlphaPattern override Rank and Alpha for modules
+	// whose names end with the key, e.g. "q_proj" or "layers.0.mlp.fc1"
+	RankPattern  map[string]int     `json:"rank_pattern"`
+	AlphaPattern map[string]float64 `json:"alpha_pattern"`
+
+	// FanInFanOut is set for modules storing their weights in x out,
+	// such as gpt2's Conv1D, rather than out x in
+	FanInFanOut bool `json:"fan_in_fan_out"`
+
+	// UseRSLoRA scales updates by alpha/sqrt(rank) rather than alpha/rank
+	UseRSLoRA bool `json:"use_rslora"`
+
+	// UseDoRA adapters also rescale each weight by learned magnitudes,
+	// which merging doesn't support
+	UseDoRA bool `json:"use_dora"`
+
+	rankPatterns, alphaPatterns map[string]*regexp.Regexp
+}
+
+// compile checks the config can be merged and compiles its rank and alpha
+// patterns.
+func (c *loraConfig) compile() error {
+	if c.UseDoRA {
+		return errors.New("dora adapters are not supported")
+	}
+
+	var err error
+	if c.rankPatterns, err = compilePatterns(c.RankPattern); err != nil {
+		return fmt.Errorf("rank_pattern: %w", err)
+	}
+
+	if c.alphaPatterns, err = compilePatterns(c.AlphaPattern); err != nil {
+		return fmt.Errorf("alpha_pattern: %w", err)
+	}
+
+	return nil
+}
+
+// compilePatterns compiles the keys of patterns to match module names the
+// same way PEFT matches rank_pattern and alpha_pattern keys.
+func compilePatterns[V any](patterns map[string]V) (map[string]*regexp.Regexp, error) {
+	res := make(map[string]*regexp.Regexp, len(patterns))
+	for key := range patterns {
+		re, err := regexp.Compile(`(^|\.)(` + key + `)$`)
+		if err != nil {
+			return nil, err
+		}
+
+		res[key] = re
+	}
+
+	return res, nil
+}
+
+// patternKey returns the key of the compiled patterns matching module. The
+// longest key wins if more than one matches.
+func patternKey(patterns map[string]*regexp.Regexp, module string) (string, bool) {
+	var match string
+	for key, re := range patterns {
+		if len(key) > len(match) && re.MatchString(module) {
+			match = key
+		}
+	}
+
+	return match, match != ""
+}
+
+// scale returns the rank and scaling of module's update, alpha/rank or
+// alpha/sqrt(rank) for rsLoRA.
+func (c *loraConfig) scale(module string) (int, float32) {
+	rank, alpha := c.Rank, c.Alpha
+	if key, ok := patternKey(c.rankPatterns, module); ok {
+		rank = c.RankPattern[key]
+	}
+
+	if key, ok := patternKey(c.alphaPatterns, module); ok {
+		alpha = c.AlphaPattern[key]
+	}
+
+	if c.UseRSLoRA {
+		return rank, float32(alpha / math.Sqrt(float64(rank)))
+	}
+
+	return rank, float32(alpha / float64(rank))
+}
+
+// loraModule holds the A and B matrices of one adapted module. A is rank x
+// in and B is out x rank.
+type loraModule struct {
+	a, b           []float32
+	aShape, bShape []uint64
+}
+
+// MergeLoRA folds the PEFT LoRA adapter in dir into the model's weights so
+// the model can be written without it. Each adapted weight W becomes
+// W + alpha/rank * B @ A. It must be called after GetTensors and before
+// WriteGGUF, and only merges into safetensors checkpoints.
+func (m *ModelData) MergeLoRA(dir string) error {
+	bts, err := os.ReadFile(filepath.Join(dir, "adapter_config.json"))
+	if err != nil {
+		return err
+	}
+
+	var cfg loraConfig
+	if err := json.Unmarshal(bts, &cfg); err != nil {
+		return fmt.Errorf("adapter_config.json: %w", err)
+	}
+
+	if err := cfg.compile(); err != nil {
+		return fmt.Errorf("adapter_config.json: %w", err)
+	}
+
+	modules, err := readLoRA(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(modules) == 0 {
+		return errors.New("adapter has no lora weights")
+	}
+
+	for module, lora := range modules {
+		if lora.a == nil || lora.b == nil {
+			return fmt.Errorf("%s: adapter needs both lora_A and lora_B", module)
+		}
+
+		name, err := m.Format.GetLayerName(module + ".weight")
+		if err != nil {
+			return err
+		}
+
+		i := -1
+		for j, t := range m.Tensors {
+			if t.Name == name {
+				i = j
+				break
+			}
+		}
+
+		if i < 0 {
+			return fmt.Errorf("%s: no base tensor %s to merge into", module, name)
+		}
+
+		wt, ok := m.Tensors[i].WriterTo.(safetensorWriterTo)
+		if !ok {
+			return fmt.Errorf("%s: lora can only be merged into safetensors weights", module)
+		}
+
+		if len(wt.t.Shape) != 2 {
+			return fmt.Errorf("%s: can't merge into weight of shape %v", module, wt.t.Shape)
+		}
+
+		rank, scale := cfg.scale(module)
+		if rank <= 0 {
+			return fmt.Errorf("%s: invalid rank %d", module, rank)
+		}
+
+		out, in := wt.t.Shape[0], wt.t.Shape[1]
+		if cfg.FanInFanOut {
+			out, in = in, out
+		}
+
+		if !equalShape(lora.aShape, uint64(rank), in) || !equalShape(lora.bShape, out, uint64(rank)) {
+			return fmt.Errorf("%s: lora_A %v and lora_B %v of rank %d don't fit weight %v", module, lora.aShape, lora.bShape, rank, wt.t.Shape)
+		}
+
+		// the update is added to the source weights before the
+		// architecture repacks them
+		repack := wt.repacker
+		wt.repacker = func(name string, data []float32, shape []uint64) ([]float32, error) {
+			for o := range out {
+				for j := range in {
+					var sum float32
+					for r := range uint64(rank) {
+						sum += lora.b[o*uint64(rank)+r] * lora.a[r*in+j]
+					}
+
+					k := o*in + j
+					if cfg.FanInFanOut {
+						k = j*out + o
+					}
+
+					data[k] += scale * sum
+				}
+			}
+
+			if repack != nil {
+				return repack(name, data, shape)
+			}
+
+			return data, nil
+		}
+
+		m.Tensors[i].WriterTo = wt
+	}
+
+	return nil
+}
+
+func equalShape(shape []uint64, rows, cols uint64) bool {
+	return len(shape) == 2 && shape[0] == rows && shape[1] == cols
+}
+
+// readLoRA reads the lora_A and lora_B weights of every safetensors file in
+// dir, keyed by the name of the module they adapt in the base checkpoint.
+func readLoRA(dir string) (map[string]*loraModule, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.safetensors"))
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make(map[string]*loraModule)
+	for _, fn := range matches {
+		bts, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bts) < 8 {
+			return nil, fmt.Errorf("%s: %w", fn, io.ErrUnexpectedEOF)
+		}
+
+		n := binary.LittleEndian.Uint64(bts)
+		if uint64(len(bts)-8) < n {
+			return nil, fmt.Errorf("%s: %w", fn, io.ErrUnexpectedEOF)
+		}
+
+		var headers map[string]json.RawMessage
+		if err := json.NewDecoder(bytes.NewReader(bts[8 : 8+n])).Decode(&headers); err != nil {
+			return nil, err
+		}
+
+		data := bts[8+n:]
+		for key, raw := range headers {
+			if key == "__metadata__" {
+				continue
+			}
+
+			var st safetensorMetadata
+			if err := json.Unmarshal(raw, &st); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+
+			module, matrix, ok := strings.Cut(strings.TrimPrefix(key, "base_model.model."), ".lora_")
+			if !ok {
+				return nil, fmt.Errorf("%s: only lora weights can be merged", key)
+			}
+
+			if len(st.Offsets) != 2 || st.Offsets[0] < 0 || st.Offsets[1] > int64(len(data)) || st.Offsets[0] > st.Offsets[1] {
+				return nil, fmt.Errorf("%s: data offsets %v out of range", key, st.Offsets)
+			}
+
+			f32s, err := safetensorWriterTo{bo: binary.LittleEndian, dtype: st.Type}.decode(data[st.Offsets[0]:st.Offsets[1]])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+
+			lora, ok := modules[module]
+			if !ok {
+				lora = &loraModule{}
+				modules[module] = lora
+			}
+
+			switch matrix {
+			case "A.weight":
+				lora.a, lora.aShape = f32s, st.Shape
+			case "B.weight":
+				lora.b, lora.bShape = f32s, st.Shape
+			default:
+				return nil, fmt.Errorf("%s: unsupported lora weight", key)
+			}
+		}
+	}
+
+	return modules, nil
+}
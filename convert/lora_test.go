@@ -0,0 +1,202 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestMergeLoRA(t *testing.T) {
+	base := t.TempDir()
+	writeJSON(t, base, "config.json", map[string]any{
+		"architectures":       []string{"PhiForCausalLM"},
+		"hidden_size":         2,
+		"intermediate_size":   4,
+		"num_hidden_layers":   1,
+		"num_attention_heads": 1,
+	})
+
+	writeBPETokenizer(t, base)
+	writeSafetensors(t, base,
+		safetensor{name: "model.embed_tokens.weight", shape: []uint64{4, 2}},
+		safetensor{name: "model.layers.0.self_attn.dense.weight", shape: []uint64{2, 2}, data: []float32{1, 2, 3, 4}},
+		safetensor{name: "model.layers.0.mlp.fc1.weight", shape: []uint64{4, 2}},
+		safetensor{name: "model.layers.0.mlp.fc2.weight", shape: []uint64{2, 4}, data: []float32{1, 1, 1, 1, 1, 1, 1, 1}},
+	)
+
+	load := func(t *testing.T) *Phi2Model {
+		t.Helper()
+
+		params, err := (&SafetensorFormat{}).GetParams(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", base, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		return arch.(*Phi2Model)
+	}
+
+	read := func(t *testing.T, m *Phi2Model, name string) []float32 {
+		t.Helper()
+
+		i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == name })
+		if i < 0 {
+			t.Fatalf("missing %s", name)
+		}
+
+		var b bytes.Buffer
+		if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+
+		f32s := make([]float32, b.Len()/4)
+		if err := binary.Read(&b, binary.LittleEndian, f32s); err != nil {
+			t.Fatal(err)
+		}
+
+		return f32s
+	}
+
+	adapter := t.TempDir()
+	writeJSON(t, adapter, "adapter_config.json", map[string]any{
+		"r":              1,
+		"lora_alpha":     2,
+		"rank_pattern":   map[string]int{"fc1": 2},
+		"alpha_pattern":  map[string]float64{"layers.0.mlp.fc1": 2},
+		"target_modules": []string{"dense", "fc1"},
+	})
+
+	writeSafetensors(t, adapter,
+		// rank 1, scaled by 2/1
+		safetensor{name: "base_model.model.model.layers.0.self_attn.dense.lora_A.weight", shape: []uint64{1, 2}, data: []float32{1, 1}},
+		safetensor{name: "base_model.model.model.layers.0.self_attn.dense.lora_B.weight", shape: []uint64{2, 1}, data: []float32{1, 2}},
+		// rank 2, scaled by 2/2
+		safetensor{name: "base_model.model.model.layers.0.mlp.fc1.lora_A.weight", shape: []uint64{2, 2}, data: []float32{1, 0, 0, 1}},
+		safetensor{name: "base_model.model.model.layers.0.mlp.fc1.lora_B.weight", shape: []uint64{4, 2}, data: []float32{1, 2, 3, 4, 5, 6, 7, 8}},
+	)
+
+	m := load(t)
+	if err := m.MergeLoRA(adapter); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string][]float32{
+		// [[1 2] [3 4]] + 2 * [[1] [2]] @ [[1 1]]
+		"blk.0.attn_output.weight": {3, 4, 7, 8},
+		// 0 + [[1 2] [3 4] [5 6] [7 8]] @ I
+		"blk.0.ffn_up.weight": {1, 2, 3, 4, 5, 6, 7, 8},
+		// not adapted
+		"blk.0.ffn_down.weight": {1, 1, 1, 1, 1, 1, 1, 1},
+	} {
+		if got := read(t, m, name); !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+
+	t.Run("fan in fan out", func(t *testing.T) {
+		adapter := t.TempDir()
+		writeJSON(t, adapter, "adapter_config.json", map[string]any{
+			"r":              1,
+			"lora_alpha":     1,
+			"fan_in_fan_out": true,
+		})
+
+		// fc2 is 2 x 4 so stored in x out it's adapted as a 4 x 2 weight
+		writeSafetensors(t, adapter,
+			safetensor{name: "base_model.model.model.layers.0.mlp.fc2.lora_A.weight", shape: []uint64{1, 2}, data: []float32{1, 2}},
+			safetensor{name: "base_model.model.model.layers.0.mlp.fc2.lora_B.weight", shape: []uint64{4, 1}, data: []float32{1, 0, 0, 1}},
+		)
+
+		m := load(t)
+		if err := m.MergeLoRA(adapter); err != nil {
+			t.Fatal(err)
+		}
+
+		// B @ A is [[1 2] [0 0] [0 0] [1 2]], added transposed
+		want := []float32{2, 1, 1, 2, 3, 1, 1, 3}
+		if got := read(t, m, "blk.0.ffn_down.weight"); !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("rslora", func(t *testing.T) {
+		adapter := t.TempDir()
+		writeJSON(t, adapter, "adapter_config.json", map[string]any{
+			"r":          4,
+			"lora_alpha": 2,
+			"use_rslora": true,
+		})
+
+		// rank 4, scaled by 2/sqrt(4) rather than 2/4
+		writeSafetensors(t, adapter,
+			safetensor{name: "base_model.model.model.layers.0.self_attn.dense.lora_A.weight", shape: []uint64{4, 2}, data: []float32{1, 0, 0, 0, 0, 0, 0, 0}},
+			safetensor{name: "base_model.model.model.layers.0.self_attn.dense.lora_B.weight", shape: []uint64{2, 4}, data: []float32{1, 0, 0, 0, 0, 0, 0, 0}},
+		)
+
+		m := load(t)
+		if err := m.MergeLoRA(adapter); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []float32{2, 2, 3, 4}
+		if got := read(t, m, "blk.0.attn_output.weight"); !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	for name, config := range map[string]map[string]any{
+		"dora":                  {"r": 1, "lora_alpha": 1, "use_dora": true},
+		"invalid rank pattern":  {"r": 1, "lora_alpha": 1, "rank_pattern": map[string]int{"fc1(": 2}},
+		"invalid alpha pattern": {"r": 1, "lora_alpha": 1, "alpha_pattern": map[string]float64{"[fc1": 2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			adapter := t.TempDir()
+			writeJSON(t, adapter, "adapter_config.json", config)
+			writeSafetensors(t, adapter,
+				safetensor{name: "base_model.model.model.layers.0.self_attn.dense.lora_A.weight", shape: []uint64{1, 2}},
+				safetensor{name: "base_model.model.model.layers.0.self_attn.dense.lora_B.weight", shape: []uint64{2, 1}},
+			)
+
+			if err := load(t).MergeLoRA(adapter); err == nil {
+				t.Errorf("expected an error for %s", name)
+			}
+		})
+	}
+
+	t.Run("rank mismatch", func(t *testing.T) {
+		adapter := t.TempDir()
+		writeJSON(t, adapter, "adapter_config.json", map[string]any{"r": 2, "lora_alpha": 2})
+		writeSafetensors(t, adapter,
+			safetensor{name: "base_model.model.model.layers.0.self_attn.dense.lora_A.weight", shape: []uint64{1, 2}},
+			safetensor{name: "base_model.model.model.layers.0.self_attn.dense.lora_B.weight", shape: []uint64{2, 1}},
+		)
+
+		if err := load(t).MergeLoRA(adapter); err == nil {
+			t.Error("expected an error for lora weights not matching the configured rank")
+		}
+	})
+
+	t.Run("missing base", func(t *testing.T) {
+		adapter := t.TempDir()
+		writeJSON(t, adapter, "adapter_config.json", map[string]any{"r": 1, "lora_alpha": 1})
+		writeSafetensors(t, adapter,
+			safetensor{name: "base_model.model.model.layers.1.self_attn.dense.lora_A.weight", shape: []uint64{1, 2}},
+			safetensor{name: "base_model.model.model.layers.1.self_attn.dense.lora_B.weight", shape: []uint64{2, 1}},
+		)
+
+		if err := load(t).MergeLoRA(adapter); err == nil {
+			t.Error("expected an error for an adapter targeting a missing layer")
+		}
+	})
+}
@@ -53,11 +53,11 @@ func (m *MistralModel) WriteGGUF(ws io.WriteSeeker) error {
 		"llama.embedding_length":                 uint32(m.Params.HiddenSize),
 		"llama.block_count":                      uint32(m.Params.HiddenLayers),
 		"llama.feed_forward_length":              uint32(m.Params.IntermediateSize),
-		"llama.rope.dimension_count":             uint32(m.Params.HiddenSize / m.Params.AttentionHeads),
+		"llama.rope.dimension_count":             uint32(m.Params.headDim()),
+		"llama.rope.freq_base":                   m.Params.ropeFreqBase(),
 		"llama.attention.head_count":             uint32(m.Params.AttentionHeads),
-		"llama.attention.head_count_kv":          uint32(m.Params.KeyValHeads),
+		"llama.attention.head_count_kv":          uint32(m.Params.kvHeads()),
 		"llama.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
-		"general.file_type":                      uint32(1),
 		"tokenizer.ggml.model":                   "llama",
 
 		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
@@ -71,7 +71,7 @@ func (m *MistralModel) WriteGGUF(ws io.WriteSeeker) error {
 		"tokenizer.ggml.unknown_token_id": uint32(0),
 	}
 
-	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
+	return m.writeGGUF(ws, kv)
 }
 
 func (m *MistralModel) Repack(name string, data []float32, shape []uint64) ([]float32, error) {
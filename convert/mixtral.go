@@ -54,18 +54,17 @@ func (m *MixtralModel) WriteGGUF(ws io.WriteSeeker) error {
 		"llama.embedding_length":        uint32(m.Params.HiddenSize),
 		"llama.feed_forward_length":     uint32(m.Params.IntermediateSize),
 		"llama.attention.head_count":    uint32(m.Params.AttentionHeads),
-		"llama.attention.head_count_kv": uint32(m.Params.KeyValHeads),
+		"llama.attention.head_count_kv": uint32(m.Params.kvHeads()),
 
-		"llama.rope.freq_base":                   float32(m.Params.RopeFrequencyBase),
+		"llama.rope.freq_base":                   m.Params.ropeFreqBase(),
 		"llama.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
 
 		"llama.expert_count":      uint32(m.Params.Experts),
 		"llama.expert_used_count": uint32(m.Params.ExpertsUsed),
 
 		"llama.vocab_size":           uint32(len(m.Vocab.Tokens)),
-		"llama.rope.dimension_count": uint32(m.Params.HiddenSize / m.Params.AttentionHeads),
+		"llama.rope.dimension_count": uint32(m.Params.headDim()),
 
-		"general.file_type":    uint32(1),
 		"tokenizer.ggml.model": "llama",
 
 		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
@@ -79,7 +78,7 @@ func (m *MixtralModel) WriteGGUF(ws io.WriteSeeker) error {
 		"tokenizer.ggml.add_eos_token":    false,
 	}
 
-	return llm.NewGGUFV3(m.Params.ByteOrder).Encode(ws, kv, m.Tensors)
+	return m.writeGGUF(ws, kv)
 }
 
 func (m *MixtralModel) Repack(name string, data []float32, shape []uint64) ([]float32, error) {
@@ -0,0 +1,93 @@
+package convert
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"path/filepath"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// attnConfig is the attn_config shared by mpt and dbrx configs.
+type attnConfig struct {
+	Alibi        bool     `json:"alibi"`
+	AlibiBiasMax float64  `json:"alibi_bias_max"`
+	ClipQKV      *float64 `json:"clip_qkv"`
+	QKLayerNorm  bool     `json:"qk_ln"`
+
+	// dbrx
+	KVHeads   int     `json:"kv_n_heads"`
+	RopeTheta float64 `json:"rope_theta"`
+}
+
+type MPTModel struct {
+	ModelData
+}
+
+func (m *MPTModel) GetTensors() error {
+	// the runner only implements mpt with alibi, there's no rope variant
+	if !m.Params.AttnConfig.Alibi {
+		return errors.New("mpt: only alibi position embeddings are supported")
+	}
+
+	if m.Params.AttnConfig.QKLayerNorm {
+		return errors.New("mpt: query/key layer norms are not supported")
+	}
+
+	// Wqkv already holds all of q, then k, then v, which is the layout the
+	// runner expects, so unlike gpt-neox nothing needs repacking
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	m.Tensors = append(m.Tensors, t...)
+	return nil
+}
+
+func (m *MPTModel) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *MPTModel) WriteGGUF(ws io.WriteSeeker) error {
+	hiddenSize := m.Params.ModelDim
+
+	kv := llm.KV{
+		"general.architecture":             "mpt",
+		"general.name":                     m.Name,
+		"mpt.context_length":               uint32(m.Params.MaxSeqLen),
+		"mpt.embedding_length":             uint32(hiddenSize),
+		"mpt.block_count":                  uint32(m.Params.ModelLayers),
+		"mpt.feed_forward_length":          uint32(cmp.Or(m.Params.ExpansionRatio, 4) * float64(hiddenSize)),
+		"mpt.attention.head_count":         uint32(m.Params.ModelHeads),
+		"mpt.attention.layer_norm_epsilon": float32(cmp.Or(m.Params.LayerNormEpsilon, 1e-5)),
+		"mpt.attention.max_alibi_bias":     float32(cmp.Or(m.Params.AttnConfig.AlibiBiasMax, 8)),
+		"tokenizer.ggml.model":             "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id": uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id": uint32(m.Params.EoSTokenID),
+	}
+
+	if clip := m.Params.AttnConfig.ClipQKV; clip != nil {
+		kv["mpt.attention.clamp_kqv"] = float32(*clip)
+	}
+
+	return m.writeGGUF(ws, kv)
+}
@@ -0,0 +1,178 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func writeMPT(t *testing.T, dir string, attnConfig map[string]any, qkv []float32) {
+	t.Helper()
+
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":   []string{"MPTForCausalLM"},
+		"d_model":         4,
+		"n_heads":         2,
+		"n_layers":        1,
+		"max_seq_len":     2048,
+		"expansion_ratio": 4,
+		"attn_config":     attnConfig,
+	})
+
+	writeBPETokenizer(t, dir)
+
+	writeSafetensors(t, dir,
+		safetensor{name: "transformer.wte.weight", shape: []uint64{4, 4}},
+		safetensor{name: "transformer.blocks.0.norm_1.weight", shape: []uint64{4}},
+		safetensor{name: "transformer.blocks.0.attn.Wqkv.weight", shape: []uint64{12, 4}, data: qkv},
+		safetensor{name: "transformer.blocks.0.attn.out_proj.weight", shape: []uint64{4, 4}},
+		safetensor{name: "transformer.blocks.0.norm_2.weight", shape: []uint64{4}},
+		safetensor{name: "transformer.blocks.0.ffn.up_proj.weight", shape: []uint64{16, 4}},
+		safetensor{name: "transformer.blocks.0.ffn.down_proj.weight", shape: []uint64{4, 16}},
+		safetensor{name: "transformer.norm_f.weight", shape: []uint64{4}},
+	)
+}
+
+func TestConvertMPT(t *testing.T) {
+	// rows 0-3 are q, 4-7 are k and 8-11 are v
+	qkv := make([]float32, 12*4)
+	for i := range qkv {
+		qkv[i] = float32(i / 4)
+	}
+
+	dir := t.TempDir()
+	writeMPT(t, dir, map[string]any{"alibi": true, "alibi_bias_max": 8, "clip_qkv": 6}, qkv)
+
+	kv, tensors := convertDir(t, dir)
+
+	expect := map[string]any{
+		"general.architecture":             "mpt",
+		"mpt.context_length":               uint32(2048),
+		"mpt.embedding_length":             uint32(4),
+		"mpt.feed_forward_length":          uint32(16),
+		"mpt.block_count":                  uint32(1),
+		"mpt.attention.head_count":         uint32(2),
+		"mpt.attention.layer_norm_epsilon": float32(1e-5),
+		"mpt.attention.max_alibi_bias":     float32(8),
+		"mpt.attention.clamp_kqv":          float32(6),
+	}
+
+	for k, v := range expect {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	if _, ok := kv["mpt.rope.dimension_count"]; ok {
+		t.Error("unexpected rope metadata for an alibi model")
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	for _, name := range []string{
+		"token_embd.weight",
+		"blk.0.attn_norm.weight",
+		"blk.0.attn_qkv.weight",
+		"blk.0.attn_output.weight",
+		"blk.0.ffn_norm.weight",
+		"blk.0.ffn_up.weight",
+		"blk.0.ffn_down.weight",
+		"output_norm.weight",
+	} {
+		if !slices.Contains(names, name) {
+			t.Errorf("missing tensor %s", name)
+		}
+	}
+
+	t.Run("wqkv", func(t *testing.T) {
+		mf, err := GetModelFormat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params, err := mf.GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.OutputType = "F32"
+
+		arch, err := mf.GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*MPTModel)
+		i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == "blk.0.attn_qkv.weight" })
+		if i < 0 {
+			t.Fatal("missing blk.0.attn_qkv.weight")
+		}
+
+		var b bytes.Buffer
+		if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]float32, len(qkv))
+		if err := binary.Read(&b, binary.LittleEndian, got); err != nil {
+			t.Fatal(err)
+		}
+
+		// q, k and v keep their rows
+		for part, name := range []string{"q", "k", "v"} {
+			rows := got[part*16 : (part+1)*16]
+			for j, f := range rows {
+				if want := float32(part*4 + j/4); f != want {
+					t.Fatalf("%s: expected %v at %d, got %v", name, want, j, f)
+				}
+			}
+		}
+	})
+}
+
+func TestConvertMPTClipUnset(t *testing.T) {
+	dir := t.TempDir()
+	writeMPT(t, dir, map[string]any{"alibi": true}, nil)
+
+	kv, _ := convertDir(t, dir)
+	if _, ok := kv["mpt.attention.clamp_kqv"]; ok {
+		t.Error("unexpected clamp_kqv without clip_qkv")
+	}
+
+	if got := kv["mpt.attention.max_alibi_bias"]; got != float32(8) {
+		t.Errorf("expected default max_alibi_bias 8, got %v", got)
+	}
+}
+
+func TestConvertMPTRope(t *testing.T) {
+	dir := t.TempDir()
+	writeMPT(t, dir, map[string]any{"alibi": false}, nil)
+
+	mf, err := GetModelFormat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := mf.GetParams(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arch, err := mf.GetModelArch("test", dir, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arch.GetTensors(); err == nil {
+		t.Error("expected an error for an mpt model without alibi")
+	}
+}
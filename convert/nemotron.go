@@ -0,0 +1,96 @@
+package convert
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// NemotronModel converts Nemotron, which differs from llama in its feed
+// forward network, a single up projection activated by squared ReLU, and its
+// layer norms, which are full layer norms with biases whose weights are
+// stored offset by one.
+type NemotronModel struct {
+	ModelData
+}
+
+func (m *NemotronModel) GetTensors() error {
+	// the runner's nemotron always squares the ReLU
+	if act := cmp.Or(m.Params.HiddenAct, "relu2"); act != "relu2" {
+		return fmt.Errorf("nemotron: activation %s is not supported", act)
+	}
+
+	// nemotron rotates halves of q and k, like neox, which is what the
+	// runner expects so nothing needs repacking
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	for i, l := range t {
+		if strings.HasSuffix(l.Name, "norm.weight") {
+			wt := l.WriterTo.(safetensorWriterTo)
+			wt.repacker = m.Repack
+			t[i].WriterTo = wt
+		}
+	}
+
+	m.Tensors = append(m.Tensors, t...)
+	return nil
+}
+
+// Repack adds one to the norm weights, which nemotron applies as 1 + w.
+func (m *NemotronModel) Repack(_ string, data []float32, shape []uint64) ([]float32, error) {
+	return addOnes(data, int(shape[0]))
+}
+
+func (m *NemotronModel) LoadVocab() error {
+	v, err := LoadSentencePieceTokens(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+	m.Vocab = v
+	return nil
+}
+
+func (m *NemotronModel) WriteGGUF(ws io.WriteSeeker) error {
+	rotaryFactor := cmp.Or(m.Params.PartialRotaryFactor, 0.5)
+
+	kv := llm.KV{
+		"general.architecture":                  "nemotron",
+		"general.name":                          m.Name,
+		"nemotron.context_length":               uint32(m.Params.ContextSize),
+		"nemotron.embedding_length":             uint32(m.Params.HiddenSize),
+		"nemotron.block_count":                  uint32(m.Params.HiddenLayers),
+		"nemotron.feed_forward_length":          uint32(m.Params.IntermediateSize),
+		"nemotron.rope.freq_base":               m.Params.ropeFreqBase(),
+		"nemotron.rope.dimension_count":         uint32(rotaryFactor * float64(m.Params.headDim())),
+		"nemotron.attention.head_count":         uint32(m.Params.AttentionHeads),
+		"nemotron.attention.head_count_kv":      uint32(m.Params.kvHeads()),
+		"nemotron.attention.layer_norm_epsilon": float32(cmp.Or(m.Params.NormEps, 1e-5)),
+
+		// the runner doesn't read the activation, it's recorded so the
+		// metadata describes the feed forward network
+		"nemotron.feed_forward_activation": "relu2",
+
+		"tokenizer.ggml.model":      "llama",
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.scores":     m.Vocab.Scores,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+
+		"tokenizer.ggml.bos_token_id":  uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":  uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.add_bos_token": true,
+		"tokenizer.ggml.add_eos_token": false,
+	}
+
+	if s := m.Params.RopeScaling; s != nil && cmp.Or(s.RopeType, s.Type) == "linear" {
+		kv["nemotron.rope.scaling.type"] = "linear"
+		kv["nemotron.rope.scaling.factor"] = float32(s.Factor)
+	}
+
+	return m.writeGGUF(ws, kv)
+}
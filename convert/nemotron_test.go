@@ -0,0 +1,169 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func testNemotronDir(t *testing.T, config map[string]any) string {
+	t.Helper()
+
+	cfg := map[string]any{
+		"architectures":           []string{"NemotronForCausalLM"},
+		"hidden_size":             8,
+		"intermediate_size":       16,
+		"num_hidden_layers":       2,
+		"num_attention_heads":     2,
+		"num_key_value_heads":     1,
+		"max_position_embeddings": 4096,
+		"norm_eps":                1e-5,
+		"hidden_act":              "relu2",
+		"partial_rotary_factor":   0.5,
+		"rope_theta":              10000,
+		"bos_token_id":            2,
+		"eos_token_id":            3,
+	}
+	for k, v := range config {
+		cfg[k] = v
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", cfg)
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+
+	ts := []safetensor{
+		{name: "model.embed_tokens.weight", shape: []uint64{6, 8}},
+		{name: "model.norm.weight", shape: []uint64{8}},
+		{name: "model.norm.bias", shape: []uint64{8}},
+		{name: "lm_head.weight", shape: []uint64{6, 8}},
+	}
+
+	for i := range 2 {
+		prefix := fmt.Sprintf("model.layers.%d.", i)
+		ts = append(ts,
+			safetensor{name: prefix + "input_layernorm.weight", shape: []uint64{8}},
+			safetensor{name: prefix + "input_layernorm.bias", shape: []uint64{8}},
+			safetensor{name: prefix + "self_attn.q_proj.weight", shape: []uint64{8, 8}},
+			safetensor{name: prefix + "self_attn.k_proj.weight", shape: []uint64{4, 8}},
+			safetensor{name: prefix + "self_attn.v_proj.weight", shape: []uint64{4, 8}},
+			safetensor{name: prefix + "self_attn.o_proj.weight", shape: []uint64{8, 8}},
+			safetensor{name: prefix + "post_attention_layernorm.weight", shape: []uint64{8}},
+			safetensor{name: prefix + "post_attention_layernorm.bias", shape: []uint64{8}},
+			safetensor{name: prefix + "mlp.up_proj.weight", shape: []uint64{16, 8}},
+			safetensor{name: prefix + "mlp.down_proj.weight", shape: []uint64{8, 16}},
+		)
+	}
+
+	writeSafetensors(t, dir, ts...)
+	return dir
+}
+
+func TestConvertNemotron(t *testing.T) {
+	kv, tensors := convertDir(t, testNemotronDir(t, map[string]any{
+		"rope_scaling": map[string]any{"type": "linear", "factor": 2},
+	}))
+
+	for k, v := range map[string]any{
+		"general.architecture":                  "nemotron",
+		"nemotron.context_length":               uint32(4096),
+		"nemotron.embedding_length":             uint32(8),
+		"nemotron.block_count":                  uint32(2),
+		"nemotron.feed_forward_length":          uint32(16),
+		"nemotron.rope.freq_base":               float32(10000),
+		"nemotron.rope.dimension_count":         uint32(2),
+		"nemotron.attention.head_count":         uint32(2),
+		"nemotron.attention.head_count_kv":      uint32(1),
+		"nemotron.attention.layer_norm_epsilon": float32(1e-5),
+		"nemotron.feed_forward_activation":      "relu2",
+		"nemotron.rope.scaling.type":            "linear",
+		"nemotron.rope.scaling.factor":          float32(2),
+		"tokenizer.ggml.model":                  "llama",
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	// a full layer norm has no rms epsilon
+	if _, ok := kv["nemotron.attention.layer_norm_rms_epsilon"]; ok {
+		t.Error("unexpected layer_norm_rms_epsilon")
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	for _, name := range []string{
+		"output_norm.weight",
+		"output_norm.bias",
+		"blk.1.attn_norm.weight",
+		"blk.1.attn_norm.bias",
+		"blk.1.ffn_norm.weight",
+		"blk.1.ffn_norm.bias",
+		"blk.1.ffn_up.weight",
+		"blk.1.ffn_down.weight",
+	} {
+		if !slices.Contains(names, name) {
+			t.Errorf("missing tensor %s", name)
+		}
+	}
+
+	if slices.Contains(names, "blk.1.ffn_gate.weight") {
+		t.Error("unexpected tensor blk.1.ffn_gate.weight")
+	}
+
+	t.Run("repacked norms", func(t *testing.T) {
+		dir := testNemotronDir(t, nil)
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*NemotronModel)
+		for name, repacked := range map[string]bool{
+			"blk.0.attn_norm.weight": true,
+			"blk.0.attn_norm.bias":   false,
+			"output_norm.weight":     true,
+			"blk.0.ffn_up.weight":    false,
+		} {
+			i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == name })
+			if i < 0 {
+				t.Fatalf("missing %s", name)
+			}
+
+			if wt := m.Tensors[i].WriterTo.(safetensorWriterTo); (wt.repacker != nil) != repacked {
+				t.Errorf("expected %s repacked %v", name, repacked)
+			}
+		}
+	})
+
+	t.Run("activation", func(t *testing.T) {
+		dir := testNemotronDir(t, map[string]any{"hidden_act": "silu"})
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err == nil {
+			t.Error("expected an error for an activation other than relu2")
+		}
+	})
+}
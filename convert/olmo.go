@@ -0,0 +1,210 @@
+package convert
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type OLMoModel struct {
+	ModelData
+}
+
+func (m *OLMoModel) kvHeads() int {
+	return cmp.Or(m.Params.ModelKVHeads, m.Params.ModelHeads)
+}
+
+// rotaryParams returns the params with olmo's head counts, which its config
+// names n_heads and n_kv_heads, where llamaRepack expects them.
+func (m *OLMoModel) rotaryParams() *Params {
+	p := *m.Params
+	p.AttentionHeads = m.Params.ModelHeads
+	p.KeyValHeads = m.kvHeads()
+	return &p
+}
+
+// ffnLength is the size of each of the two halves of the fused ff_proj,
+// which defaults to mlp_ratio times d_model.
+func (m *OLMoModel) ffnLength() int {
+	hidden := m.Params.MLPHiddenSize
+	if hidden == 0 {
+		hidden = int(cmp.Or(m.Params.MLPRatio, 4) * float64(m.Params.ModelDim))
+	}
+
+	return hidden / 2
+}
+
+func (m *OLMoModel) GetTensors() error {
+	// the runner's olmo has no norm weights or biases at all, its layer
+	// norms are non-parametric
+	if m.Params.LayerNormWithAffine {
+		return errors.New("olmo: layer norms with affine weights are not supported")
+	}
+
+	if m.Params.IncludeBias {
+		return errors.New("olmo: linear biases are not supported")
+	}
+
+	if m.Params.AttentionLayerNorm {
+		return errors.New("olmo: query/key layer norms are not supported")
+	}
+
+	if m.Params.ModelHeads == 0 {
+		return errors.New("olmo: n_heads is not set")
+	}
+
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	headDim := m.Params.ModelDim / m.Params.ModelHeads
+	for _, l := range t {
+		var fused string
+		var parts []rowSplit
+		switch {
+		case strings.HasSuffix(l.Name, "attn_qkv.weight"):
+			fused = "attn_qkv.weight"
+			kvDim := m.kvHeads() * headDim
+			parts = []rowSplit{
+				{"attn_q", m.Params.ModelDim},
+				{"attn_k", kvDim},
+				{"attn_v", kvDim},
+			}
+		case strings.HasSuffix(l.Name, "ffn_up_gate.weight"):
+			fused = "ffn_up_gate.weight"
+			// ff_proj is chunked into x and the gate, in that order
+			parts = []rowSplit{
+				{"ffn_up", m.ffnLength()},
+				{"ffn_gate", m.ffnLength()},
+			}
+		default:
+			m.Tensors = append(m.Tensors, l)
+			continue
+		}
+
+		ts, err := splitRows(l, strings.TrimSuffix(l.Name, fused), parts)
+		if err != nil {
+			return err
+		}
+
+		if fused == "attn_qkv.weight" {
+			// olmo rotates halves of q and k, like neox, while the runner
+			// rotates interleaved pairs, so they're permuted like llama's
+			for i := range ts[:2] {
+				wt := ts[i].WriterTo.(safetensorWriterTo)
+				split := wt.repacker
+				wt.repacker = func(name string, data []float32, shape []uint64) ([]float32, error) {
+					data, err := split(name, data, shape)
+					if err != nil {
+						return nil, err
+					}
+
+					return llamaRepack(name, m.rotaryParams(), data, shape)
+				}
+				ts[i].WriterTo = wt
+			}
+		}
+
+		m.Tensors = append(m.Tensors, ts...)
+	}
+
+	return nil
+}
+
+// rowSplit is one of the tensors a fused projection is split into, taking
+// the next rows rows.
+type rowSplit struct {
+	name string
+	rows int
+}
+
+// splitRows splits the fused projection t into consecutive runs of rows,
+// named prefix followed by each part's name. Each split tensor reads the
+// whole projection and keeps its own rows.
+func splitRows(t llm.Tensor, prefix string, parts []rowSplit) ([]llm.Tensor, error) {
+	var total int
+	for _, part := range parts {
+		total += part.rows
+	}
+
+	if len(t.Shape) != 2 || t.Shape[0] != uint64(total) {
+		return nil, fmt.Errorf("%s: shape %v doesn't match the %d rows of %v", t.Name, t.Shape, total, parts)
+	}
+
+	var ts []llm.Tensor
+	var start int
+	for _, part := range parts {
+		split := llm.Tensor{
+			Name:  prefix + part.name + ".weight",
+			Kind:  t.Kind,
+			Shape: []uint64{uint64(part.rows), t.Shape[1]},
+		}
+
+		cols := int(t.Shape[1])
+		from, to := start*cols, (start+part.rows)*cols
+
+		wt := t.WriterTo.(safetensorWriterTo)
+		wt.t = &split
+		wt.repacker = func(_ string, data []float32, _ []uint64) ([]float32, error) {
+			return data[from:to], nil
+		}
+
+		split.WriterTo = wt
+		ts = append(ts, split)
+		start += part.rows
+	}
+
+	return ts, nil
+}
+
+func (m *OLMoModel) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *OLMoModel) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":              "olmo",
+		"general.name":                      m.Name,
+		"olmo.context_length":               uint32(m.Params.MaxSequenceLength),
+		"olmo.embedding_length":             uint32(m.Params.ModelDim),
+		"olmo.block_count":                  uint32(m.Params.ModelLayers),
+		"olmo.feed_forward_length":          uint32(m.ffnLength()),
+		"olmo.rope.freq_base":               float32(cmp.Or(m.Params.RopeFrequencyBase, 10000)),
+		"olmo.attention.head_count":         uint32(m.Params.ModelHeads),
+		"olmo.attention.head_count_kv":      uint32(m.kvHeads()),
+		"olmo.attention.layer_norm_epsilon": float32(1e-5),
+		"tokenizer.ggml.model":              "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id":     uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":     uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.padding_token_id": uint32(m.Params.PaddingTokenID),
+	}
+
+	if clip := m.Params.ClipQKV; clip != nil {
+		kv["olmo.attention.clamp_kqv"] = float32(*clip)
+	}
+
+	return m.writeGGUF(ws, kv)
+}
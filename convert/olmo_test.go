@@ -0,0 +1,252 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func testOLMoDir(t *testing.T, config map[string]any) string {
+	t.Helper()
+
+	// every element of the fused projections holds its row number
+	rows := func(n int) []float32 {
+		f32s := make([]float32, n*4)
+		for i := range f32s {
+			f32s[i] = float32(i / 4)
+		}
+
+		return f32s
+	}
+
+	cfg := map[string]any{
+		"architectures":          []string{"OLMoForCausalLM"},
+		"auto_map":               map[string]any{"AutoModelForCausalLM": "hf_olmo.OLMoForCausalLM"},
+		"d_model":                4,
+		"n_heads":                2,
+		"n_kv_heads":             1,
+		"n_layers":               1,
+		"mlp_hidden_size":        16,
+		"max_sequence_length":    2048,
+		"rope_theta":             500000,
+		"layer_norm_type":        "default",
+		"layer_norm_with_affine": false,
+		"include_bias":           false,
+		"weight_tying":           false,
+		"eos_token_id":           5,
+		"pad_token_id":           1,
+	}
+	for k, v := range config {
+		cfg[k] = v
+	}
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", cfg)
+	writeBPETokenizer(t, dir)
+	writeSafetensors(t, dir,
+		safetensor{name: "model.transformer.wte.weight", shape: []uint64{6, 4}},
+		safetensor{name: "model.transformer.blocks.0.att_proj.weight", shape: []uint64{8, 4}, data: rows(8)},
+		safetensor{name: "model.transformer.blocks.0.attn_out.weight", shape: []uint64{4, 4}},
+		safetensor{name: "model.transformer.blocks.0.ff_proj.weight", shape: []uint64{16, 4}, data: rows(16)},
+		safetensor{name: "model.transformer.blocks.0.ff_out.weight", shape: []uint64{4, 8}},
+		safetensor{name: "model.transformer.ff_out.weight", shape: []uint64{6, 4}},
+	)
+
+	return dir
+}
+
+func TestConvertOLMo(t *testing.T) {
+	dir := testOLMoDir(t, map[string]any{"clip_qkv": 8})
+	kv, tensors := convertDir(t, dir)
+
+	expect := map[string]any{
+		"general.architecture":              "olmo",
+		"olmo.context_length":               uint32(2048),
+		"olmo.embedding_length":             uint32(4),
+		"olmo.block_count":                  uint32(1),
+		"olmo.feed_forward_length":          uint32(8),
+		"olmo.rope.freq_base":               float32(500000),
+		"olmo.attention.head_count":         uint32(2),
+		"olmo.attention.head_count_kv":      uint32(1),
+		"olmo.attention.layer_norm_epsilon": float32(1e-5),
+		"olmo.attention.clamp_kqv":          float32(8),
+		"tokenizer.ggml.eos_token_id":       uint32(5),
+		"tokenizer.ggml.padding_token_id":   uint32(1),
+	}
+
+	for k, v := range expect {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+	slices.Sort(names)
+
+	// the layer norms are non-parametric so there's no norm tensor to
+	// write, or to expect
+	want := []string{
+		"blk.0.attn_k.weight",
+		"blk.0.attn_output.weight",
+		"blk.0.attn_q.weight",
+		"blk.0.attn_v.weight",
+		"blk.0.ffn_down.weight",
+		"blk.0.ffn_gate.weight",
+		"blk.0.ffn_up.weight",
+		"output.weight",
+		"token_embd.weight",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("expected tensors %v, got %v", want, names)
+	}
+
+	for _, name := range names {
+		if strings.Contains(name, "norm") {
+			t.Errorf("unexpected norm tensor %s", name)
+		}
+	}
+
+	t.Run("clip unset", func(t *testing.T) {
+		kv, _ := convertDir(t, testOLMoDir(t, nil))
+		if _, ok := kv["olmo.attention.clamp_kqv"]; ok {
+			t.Error("unexpected clamp_kqv without clip_qkv")
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.OutputType = "F32"
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*OLMoModel)
+		for name, rows := range map[string][]float32{
+			"blk.0.attn_q.weight":   {0, 1, 2, 3},
+			"blk.0.attn_k.weight":   {4, 5},
+			"blk.0.attn_v.weight":   {6, 7},
+			"blk.0.ffn_up.weight":   {0, 1, 2, 3, 4, 5, 6, 7},
+			"blk.0.ffn_gate.weight": {8, 9, 10, 11, 12, 13, 14, 15},
+		} {
+			i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == name })
+			if i < 0 {
+				t.Fatalf("missing %s", name)
+			}
+
+			var b bytes.Buffer
+			if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]float32, len(rows)*4)
+			if err := binary.Read(&b, binary.LittleEndian, got); err != nil {
+				t.Fatal(err)
+			}
+
+			for k, f := range got {
+				if want := rows[k/4]; f != want {
+					t.Fatalf("%s: expected %v at %d, got %v", name, want, k, f)
+				}
+			}
+		}
+	})
+
+	t.Run("rotary", func(t *testing.T) {
+		// a single head of four dimensions so the rotary halves are
+		// permuted into interleaved pairs
+		dir := testOLMoDir(t, map[string]any{"n_heads": 1, "n_kv_heads": 1})
+
+		f32s := make([]float32, 12*4)
+		for i := range f32s {
+			f32s[i] = float32(i / 4)
+		}
+
+		writeSafetensors(t, dir,
+			safetensor{name: "model.transformer.wte.weight", shape: []uint64{6, 4}},
+			safetensor{name: "model.transformer.blocks.0.att_proj.weight", shape: []uint64{12, 4}, data: f32s},
+		)
+
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.OutputType = "F32"
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*OLMoModel)
+		for name, rows := range map[string][]float32{
+			"blk.0.attn_q.weight": {0, 2, 1, 3},
+			"blk.0.attn_k.weight": {4, 6, 5, 7},
+			"blk.0.attn_v.weight": {8, 9, 10, 11},
+		} {
+			i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == name })
+			if i < 0 {
+				t.Fatalf("missing %s", name)
+			}
+
+			var b bytes.Buffer
+			if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]float32, len(rows)*4)
+			if err := binary.Read(&b, binary.LittleEndian, got); err != nil {
+				t.Fatal(err)
+			}
+
+			for k, f := range got {
+				if want := rows[k/4]; f != want {
+					t.Fatalf("%s: expected %v at %d, got %v", name, want, k, f)
+				}
+			}
+		}
+	})
+
+	for key, value := range map[string]any{
+		"layer_norm_with_affine": true,
+		"include_bias":           true,
+		"attention_layer_norm":   true,
+	} {
+		t.Run(key, func(t *testing.T) {
+			dir := testOLMoDir(t, map[string]any{key: value})
+
+			params, err := (&SafetensorFormat{}).GetParams(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := arch.GetTensors(); err == nil {
+				t.Errorf("expected an error with %s set", key)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package convert
+
+import (
+	"cmp"
+	"io"
+	"path/filepath"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type Phi2Model struct {
+	ModelData
+}
+
+func (m *Phi2Model) GetTensors() error {
+	// phi2 uses neox style rotary embeddings so unlike llama q and k don't
+	// need repacking
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	m.Tensors = append(m.Tensors, t...)
+	return nil
+}
+
+func (m *Phi2Model) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *Phi2Model) WriteGGUF(ws io.WriteSeeker) error {
+	rotaryFactor := cmp.Or(m.Params.PartialRotaryFactor, 0.5)
+
+	kv := llm.KV{
+		"general.architecture":         "phi2",
+		"general.name":                 m.Name,
+		"phi2.context_length":          uint32(m.Params.ContextSize),
+		"phi2.embedding_length":        uint32(m.Params.HiddenSize),
+		"phi2.block_count":             uint32(m.Params.HiddenLayers),
+		"phi2.feed_forward_length":     uint32(m.Params.IntermediateSize),
+		"phi2.rope.dimension_count":    uint32(rotaryFactor * float64(m.Params.headDim())),
+		"phi2.rope.freq_base":          m.Params.ropeFreqBase(),
+		"phi2.attention.head_count":    uint32(m.Params.AttentionHeads),
+		"phi2.attention.head_count_kv": uint32(m.Params.kvHeads()),
+		// phi2 norms are LayerNorms with a bias rather than RMS norms
+		"phi2.attention.layer_norm_epsilon": float32(cmp.Or(m.Params.LayerNormEPS, 1e-5)),
+		// attention and the feed forward network share the same input and
+		// their outputs are summed
+		"phi2.use_parallel_residual": true,
+		"tokenizer.ggml.model":       "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id":  uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":  uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.add_bos_token": false,
+	}
+
+	return m.writeGGUF(ws, kv)
+}
@@ -0,0 +1,102 @@
+package convert
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConvertPhi2(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":           []string{"PhiForCausalLM"},
+		"hidden_size":             8,
+		"intermediate_size":       32,
+		"num_hidden_layers":       1,
+		"num_attention_heads":     2,
+		"max_position_embeddings": 2048,
+		"layer_norm_eps":          1e-5,
+		"partial_rotary_factor":   0.5,
+	})
+
+	writeBPETokenizer(t, dir)
+
+	var ts []safetensor
+	for _, name := range []string{
+		"model.layers.0.input_layernorm",
+		"model.layers.0.self_attn.q_proj",
+		"model.layers.0.self_attn.k_proj",
+		"model.layers.0.self_attn.v_proj",
+		"model.layers.0.self_attn.dense",
+		"model.final_layernorm",
+	} {
+		shape := []uint64{8, 8}
+		if name == "model.layers.0.input_layernorm" || name == "model.final_layernorm" {
+			shape = []uint64{8}
+		}
+
+		ts = append(ts,
+			safetensor{name: name + ".weight", shape: shape},
+			safetensor{name: name + ".bias", shape: []uint64{8}},
+		)
+	}
+
+	ts = append(ts,
+		safetensor{name: "model.embed_tokens.weight", shape: []uint64{4, 8}},
+		safetensor{name: "model.layers.0.mlp.fc1.weight", shape: []uint64{32, 8}},
+		safetensor{name: "model.layers.0.mlp.fc1.bias", shape: []uint64{32}},
+		safetensor{name: "model.layers.0.mlp.fc2.weight", shape: []uint64{8, 32}},
+		safetensor{name: "model.layers.0.mlp.fc2.bias", shape: []uint64{8}},
+		safetensor{name: "lm_head.weight", shape: []uint64{4, 8}},
+		safetensor{name: "lm_head.bias", shape: []uint64{4}},
+	)
+
+	writeSafetensors(t, dir, ts...)
+
+	kv, tensors := convertDir(t, dir)
+
+	for k, v := range map[string]any{
+		"general.architecture":              "phi2",
+		"phi2.context_length":               uint32(2048),
+		"phi2.embedding_length":             uint32(8),
+		"phi2.feed_forward_length":          uint32(32),
+		"phi2.block_count":                  uint32(1),
+		"phi2.attention.head_count":         uint32(2),
+		"phi2.attention.head_count_kv":      uint32(2),
+		"phi2.rope.dimension_count":         uint32(2),
+		"phi2.attention.layer_norm_epsilon": float32(1e-5),
+		"phi2.use_parallel_residual":        true,
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	for _, name := range []string{
+		"token_embd.weight",
+		"blk.0.attn_norm.weight",
+		"blk.0.attn_norm.bias",
+		"blk.0.attn_q.weight",
+		"blk.0.attn_q.bias",
+		"blk.0.attn_k.bias",
+		"blk.0.attn_v.bias",
+		"blk.0.attn_output.weight",
+		"blk.0.attn_output.bias",
+		"blk.0.ffn_up.weight",
+		"blk.0.ffn_up.bias",
+		"blk.0.ffn_down.weight",
+		"blk.0.ffn_down.bias",
+		"output_norm.weight",
+		"output_norm.bias",
+		"output.weight",
+		"output.bias",
+	} {
+		if !slices.Contains(names, name) {
+			t.Errorf("missing tensor %s", name)
+		}
+	}
+}
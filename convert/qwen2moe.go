@@ -0,0 +1,84 @@
+package convert
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type Qwen2MoEModel struct {
+	ModelData
+}
+
+func (m *Qwen2MoEModel) GetTensors() error {
+	// qwen2 uses neox style rotary embeddings so unlike llama q and k don't
+	// need repacking
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	// routed experts are stored one tensor per expert and stacked into a
+	// single tensor per layer. The shared expert is a regular feed forward
+	// network, gated by ffn_gate_inp_shexp, and is written as is
+	ts, err := stackExperts("qwen2moe", t, m.Params.NumExperts)
+	if err != nil {
+		return err
+	}
+
+	m.Tensors = append(m.Tensors, ts...)
+	return nil
+}
+
+func (m *Qwen2MoEModel) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *Qwen2MoEModel) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":                      "qwen2moe",
+		"general.name":                              m.Name,
+		"qwen2moe.context_length":                   uint32(m.Params.ContextSize),
+		"qwen2moe.embedding_length":                 uint32(m.Params.HiddenSize),
+		"qwen2moe.block_count":                      uint32(m.Params.HiddenLayers),
+		"qwen2moe.feed_forward_length":              uint32(m.Params.IntermediateSize),
+		"qwen2moe.rope.freq_base":                   m.Params.ropeFreqBase(),
+		"qwen2moe.attention.head_count":             uint32(m.Params.AttentionHeads),
+		"qwen2moe.attention.head_count_kv":          uint32(m.Params.kvHeads()),
+		"qwen2moe.attention.layer_norm_rms_epsilon": float32(m.Params.NormEPS),
+
+		"qwen2moe.expert_count":                      uint32(m.Params.NumExperts),
+		"qwen2moe.expert_used_count":                 uint32(m.Params.ExpertsUsed),
+		"qwen2moe.expert_feed_forward_length":        uint32(m.Params.MoEIntermediateSize),
+		"qwen2moe.expert_shared_count":               uint32(1),
+		"qwen2moe.expert_shared_feed_forward_length": uint32(m.Params.SharedExpertIntermediateSize),
+
+		// the pretokenizer belongs to the architecture so it isn't
+		// detected from tokenizer.json
+		"tokenizer.ggml.model": "gpt2",
+		"tokenizer.ggml.pre":   "qwen2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id":  uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":  uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.add_bos_token": false,
+	}
+
+	return m.writeGGUF(ws, kv)
+}
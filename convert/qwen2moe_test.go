@@ -0,0 +1,185 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func TestConvertQwen2MoE(t *testing.T) {
+	const (
+		hidden  = 4
+		experts = 3
+		moeFFN  = 2
+		shared  = 6
+	)
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":                   []string{"Qwen2MoeForCausalLM"},
+		"hidden_size":                     hidden,
+		"intermediate_size":               8,
+		"moe_intermediate_size":           moeFFN,
+		"shared_expert_intermediate_size": shared,
+		"num_experts":                     experts,
+		"num_experts_per_tok":             2,
+		"num_hidden_layers":               1,
+		"num_attention_heads":             2,
+		"num_key_value_heads":             1,
+		"max_position_embeddings":         32768,
+		"rms_norm_eps":                    1e-6,
+		"rope_theta":                      1000000,
+	})
+
+	writeBPETokenizer(t, dir)
+
+	ts := []safetensor{
+		{name: "model.embed_tokens.weight", shape: []uint64{4, hidden}},
+		{name: "model.layers.0.input_layernorm.weight", shape: []uint64{hidden}},
+		{name: "model.layers.0.self_attn.q_proj.weight", shape: []uint64{hidden, hidden}},
+		{name: "model.layers.0.self_attn.q_proj.bias", shape: []uint64{hidden}},
+		{name: "model.layers.0.self_attn.k_proj.weight", shape: []uint64{2, hidden}},
+		{name: "model.layers.0.self_attn.k_proj.bias", shape: []uint64{2}},
+		{name: "model.layers.0.self_attn.v_proj.weight", shape: []uint64{2, hidden}},
+		{name: "model.layers.0.self_attn.v_proj.bias", shape: []uint64{2}},
+		{name: "model.layers.0.self_attn.o_proj.weight", shape: []uint64{hidden, hidden}},
+		{name: "model.layers.0.post_attention_layernorm.weight", shape: []uint64{hidden}},
+		{name: "model.layers.0.mlp.gate.weight", shape: []uint64{experts, hidden}},
+		{name: "model.layers.0.mlp.shared_expert.gate_proj.weight", shape: []uint64{shared, hidden}},
+		{name: "model.layers.0.mlp.shared_expert.up_proj.weight", shape: []uint64{shared, hidden}},
+		{name: "model.layers.0.mlp.shared_expert.down_proj.weight", shape: []uint64{hidden, shared}},
+		{name: "model.layers.0.mlp.shared_expert_gate.weight", shape: []uint64{1, hidden}},
+		{name: "model.norm.weight", shape: []uint64{hidden}},
+		{name: "lm_head.weight", shape: []uint64{4, hidden}},
+	}
+
+	// every element of an expert's gate projection holds the expert's index
+	for e := range experts {
+		gate := make([]float32, moeFFN*hidden)
+		for i := range gate {
+			gate[i] = float32(e)
+		}
+
+		prefix := fmt.Sprintf("model.layers.0.mlp.experts.%d.", e)
+		ts = append(ts,
+			safetensor{name: prefix + "gate_proj.weight", shape: []uint64{moeFFN, hidden}, data: gate},
+			safetensor{name: prefix + "up_proj.weight", shape: []uint64{moeFFN, hidden}},
+			safetensor{name: prefix + "down_proj.weight", shape: []uint64{hidden, moeFFN}},
+		)
+	}
+
+	writeSafetensors(t, dir, ts...)
+
+	kv, tensors := convertDir(t, dir)
+
+	for k, v := range map[string]any{
+		"general.architecture":                       "qwen2moe",
+		"qwen2moe.context_length":                    uint32(32768),
+		"qwen2moe.embedding_length":                  uint32(hidden),
+		"qwen2moe.feed_forward_length":               uint32(8),
+		"qwen2moe.attention.head_count":              uint32(2),
+		"qwen2moe.attention.head_count_kv":           uint32(1),
+		"qwen2moe.rope.freq_base":                    float32(1000000),
+		"qwen2moe.expert_count":                      uint32(experts),
+		"qwen2moe.expert_used_count":                 uint32(2),
+		"qwen2moe.expert_feed_forward_length":        uint32(moeFFN),
+		"qwen2moe.expert_shared_count":               uint32(1),
+		"qwen2moe.expert_shared_feed_forward_length": uint32(shared),
+		"tokenizer.ggml.pre":                         "qwen2",
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	shapes := make(map[string][]uint64)
+	for _, t := range tensors {
+		shapes[t.Name] = t.Shape
+	}
+
+	// decoded shapes are reversed and padded to four dimensions
+	for name, shape := range map[string][]uint64{
+		// routed experts, stacked
+		"blk.0.ffn_gate_inp.weight":  {hidden, experts},
+		"blk.0.ffn_gate_exps.weight": {hidden, moeFFN, experts},
+		"blk.0.ffn_up_exps.weight":   {hidden, moeFFN, experts},
+		"blk.0.ffn_down_exps.weight": {moeFFN, hidden, experts},
+		// shared expert
+		"blk.0.ffn_gate_inp_shexp.weight": {hidden, 1},
+		"blk.0.ffn_gate_shexp.weight":     {hidden, shared},
+		"blk.0.ffn_up_shexp.weight":       {hidden, shared},
+		"blk.0.ffn_down_shexp.weight":     {shared, hidden},
+		"blk.0.attn_k.bias":               {2},
+	} {
+		if got, ok := shapes[name]; !ok {
+			t.Errorf("missing tensor %s", name)
+		} else if !slices.Equal(got[:len(shape)], shape) {
+			t.Errorf("expected %s shape %v, got %v", name, shape, got[:len(shape)])
+		}
+	}
+
+	if _, ok := shapes["blk.0.ffn_gate.0.weight"]; ok {
+		t.Error("unexpected unstacked expert blk.0.ffn_gate.0.weight")
+	}
+
+	t.Run("stacked", func(t *testing.T) {
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.OutputType = "F32"
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err != nil {
+			t.Fatal(err)
+		}
+
+		m := arch.(*Qwen2MoEModel)
+		i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == "blk.0.ffn_gate_exps.weight" })
+		if i < 0 {
+			t.Fatal("missing blk.0.ffn_gate_exps.weight")
+		}
+
+		var b bytes.Buffer
+		if _, err := m.Tensors[i].WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]float32, experts*moeFFN*hidden)
+		if err := binary.Read(&b, binary.LittleEndian, got); err != nil {
+			t.Fatal(err)
+		}
+
+		// experts are stacked in order
+		for k, f := range got {
+			if want := float32(k / (moeFFN * hidden)); f != want {
+				t.Fatalf("expected %v at %d, got %v", want, k, f)
+			}
+		}
+	})
+
+	t.Run("missing expert", func(t *testing.T) {
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.NumExperts = experts + 1
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err == nil {
+			t.Error("expected an error for a layer missing experts")
+		}
+	})
+}
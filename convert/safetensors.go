@@ -2,10 +2,12 @@ package convert
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -47,10 +49,16 @@ func (m *SafetensorFormat) GetTensors(dirpath string, params *Params) ([]llm.Ten
 	}
 
 	var offset uint64
+	renamer := params.renamer()
+	skipper, err := params.skipper()
+	if err != nil {
+		return nil, err
+	}
+
 	for _, f := range matches {
 		var t []llm.Tensor
 		var err error
-		t, offset, err = m.readTensors(f, offset, params)
+		t, offset, err = m.readTensors(f, offset, params, renamer, skipper)
 		if err != nil {
 			return nil, err
 		}
@@ -60,7 +68,7 @@ func (m *SafetensorFormat) GetTensors(dirpath string, params *Params) ([]llm.Ten
 	return tensors, nil
 }
 
-func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params) ([]llm.Tensor, uint64, error) {
+func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params, renamer *tensorRenamer, skipper tensorSkipper) ([]llm.Tensor, uint64, error) {
 	f, err := os.Open(fn)
 	if err != nil {
 		return nil, 0, err
@@ -84,27 +92,42 @@ func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params)
 
 	var keys []string
 	for key := range headers {
-		if !strings.HasSuffix(key, "self_attn.rotary_embd.inv_freq") {
-			keys = append(keys, key)
+		if skipTensor(key) {
+			continue
 		}
+
+		if skipper.skipped(key) {
+			continue
+		}
+
+		keys = append(keys, key)
 	}
 
-	slices.Sort(keys)
+	// follow the order tensors are stored in so they're read sequentially
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Compare(headers[a].Offsets[0], headers[b].Offsets[0])
+	})
 
 	var tensors []llm.Tensor
 	for _, key := range keys {
 		value := headers[key]
 
-		var kind uint32
-		switch len(value.Shape) {
-		case 0:
+		if len(value.Shape) == 0 {
 			// valuedata
 			continue
-		case 2:
-			kind = 1
 		}
 
-		name, err := m.GetLayerName(key)
+		kind, err := params.tensorKind(value.Type, len(value.Shape))
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", key, err)
+		}
+
+		renamed, err := renamer.rename(key)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		name, err := m.GetLayerName(renamed)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -140,6 +163,27 @@ func (m *SafetensorFormat) readTensors(fn string, offset uint64, params *Params)
 	return tensors, offset, nil
 }
 
+// skipTensor reports whether key is a buffer, such as precomputed rotary
+// frequencies or attention masks, rather than model weights.
+func skipTensor(key string) bool {
+	for _, suffix := range []string{
+		"self_attn.rotary_embd.inv_freq",
+		"embeddings.position_ids",
+		"attention.rotary_emb.inv_freq",
+		"attention.masked_bias",
+		"attention.bias",
+		// gpt2's causal mask buffers, not c_attn.bias
+		".attn.bias",
+		".attn.masked_bias",
+	} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (m *SafetensorFormat) GetParams(dirpath string) (*Params, error) {
 	f, err := os.Open(filepath.Join(dirpath, "config.json"))
 	if err != nil {
@@ -157,6 +201,142 @@ func (m *SafetensorFormat) GetParams(dirpath string) (*Params, error) {
 	return &params, nil
 }
 
+// safetensorLayerNames maps tensor names, which must match the whole
+// pattern, to their gguf names. The patterns are compiled once and checked in
+// order so the first match wins.
+var safetensorLayerNames = compileLayerNames([][2]string{
+	// bert checkpoints may or may not carry the "bert." prefix
+	{"(?:bert\\.)?embeddings\\.word_embeddings\\.weight", "token_embd.weight"},
+	{"(?:bert\\.)?embeddings\\.token_type_embeddings\\.weight", "token_types.weight"},
+	{"(?:bert\\.)?embeddings\\.position_embeddings\\.weight", "position_embd.weight"},
+	{"(?:bert\\.)?embeddings\\.LayerNorm\\.(weight|bias)", "token_embd_norm.$1"},
+	{"(?:bert\\.)?encoder\\.layer\\.(\\d+)\\.attention\\.self\\.query\\.(weight|bias)", "blk.$1.attn_q.$2"},
+	{"(?:bert\\.)?encoder\\.layer\\.(\\d+)\\.attention\\.self\\.key\\.(weight|bias)", "blk.$1.attn_k.$2"},
+	{"(?:bert\\.)?encoder\\.layer\\.(\\d+)\\.attention\\.self\\.value\\.(weight|bias)", "blk.$1.attn_v.$2"},
+	{"(?:bert\\.)?encoder\\.layer\\.(\\d+)\\.attention\\.output\\.dense\\.(weight|bias)", "blk.$1.attn_output.$2"},
+	{"(?:bert\\.)?encoder\\.layer\\.(\\d+)\\.attention\\.output\\.LayerNorm\\.(weight|bias)", "blk.$1.attn_output_norm.$2"},
+	{"(?:bert\\.)?encoder\\.layer\\.(\\d+)\\.intermediate\\.dense\\.(weight|bias)", "blk.$1.ffn_up.$2"},
+	{"(?:bert\\.)?encoder\\.layer\\.(\\d+)\\.output\\.dense\\.(weight|bias)", "blk.$1.ffn_down.$2"},
+	{"(?:bert\\.)?encoder\\.layer\\.(\\d+)\\.output\\.LayerNorm\\.(weight|bias)", "blk.$1.layer_output_norm.$2"},
+	{"(?:bert\\.)?pooler\\.dense\\.(weight|bias)", "pooler.dense.$1"},
+
+	{"gpt_neox\\.embed_in\\.weight", "token_embd.weight"},
+	{"gpt_neox\\.final_layer_norm\\.(weight|bias)", "output_norm.$1"},
+	{"embed_out\\.weight", "output.weight"},
+	{"gpt_neox\\.layers\\.(\\d+)\\.input_layernorm\\.(weight|bias)", "blk.$1.attn_norm.$2"},
+	{"gpt_neox\\.layers\\.(\\d+)\\.post_attention_layernorm\\.(weight|bias)", "blk.$1.ffn_norm.$2"},
+	{"gpt_neox\\.layers\\.(\\d+)\\.attention\\.query_key_value\\.(weight|bias)", "blk.$1.attn_qkv.$2"},
+	{"gpt_neox\\.layers\\.(\\d+)\\.attention\\.dense\\.(weight|bias)", "blk.$1.attn_output.$2"},
+	{"gpt_neox\\.layers\\.(\\d+)\\.mlp\\.dense_h_to_4h\\.(weight|bias)", "blk.$1.ffn_up.$2"},
+	{"gpt_neox\\.layers\\.(\\d+)\\.mlp\\.dense_4h_to_h\\.(weight|bias)", "blk.$1.ffn_down.$2"},
+
+	{"lm_head\\.bias", "output.bias"},
+	{"model\\.final_layernorm\\.(weight|bias)", "output_norm.$1"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.dense\\.(weight|bias)", "blk.$1.attn_output.$2"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.fc1\\.(weight|bias)", "blk.$1.ffn_up.$2"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.fc2\\.(weight|bias)", "blk.$1.ffn_down.$2"},
+	{"model\\.norm\\.bias", "output_norm.bias"},
+	{"model\\.layers\\.(\\d+)\\.input_layernorm\\.bias", "blk.$1.attn_norm.bias"},
+	{"model\\.layers\\.(\\d+)\\.post_attention_layernorm\\.bias", "blk.$1.ffn_norm.bias"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.(q|k|v)_proj\\.bias", "blk.$1.attn_$2.bias"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.o_proj\\.bias", "blk.$1.attn_output.bias"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.c_fc\\.(weight|bias)", "blk.$1.ffn_up.$2"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.c_proj\\.(weight|bias)", "blk.$1.ffn_down.$2"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.W_pack\\.weight", "blk.$1.attn_qkv.weight"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.gate\\.weight", "blk.$1.ffn_gate_inp.weight"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.experts\\.(\\d+)\\.(gate|up|down)_proj\\.weight", "blk.$1.ffn_$3.$2.weight"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.shared_expert\\.(gate|up|down)_proj\\.weight", "blk.$1.ffn_${2}_shexp.weight"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.shared_expert_gate\\.weight", "blk.$1.ffn_gate_inp_shexp.weight"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.(q|k)_norm\\.weight", "blk.$1.attn_${2}_norm.weight"},
+	// gemma3 norms after attention and around the feed forward network
+	{"model\\.layers\\.(\\d+)\\.pre_feedforward_layernorm\\.weight", "blk.$1.pre_ffw_norm.weight"},
+	{"model\\.layers\\.(\\d+)\\.post_feedforward_layernorm\\.weight", "blk.$1.post_ffw_norm.weight"},
+
+	// deepseek2's multi-head latent attention
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.q_a_proj\\.weight", "blk.$1.attn_q_a.weight"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.q_a_layernorm\\.weight", "blk.$1.attn_q_a_norm.weight"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.q_b_proj\\.weight", "blk.$1.attn_q_b.weight"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.kv_a_proj_with_mqa\\.weight", "blk.$1.attn_kv_a_mqa.weight"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.kv_a_layernorm\\.weight", "blk.$1.attn_kv_a_norm.weight"},
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.kv_b_proj\\.weight", "blk.$1.attn_kv_b.weight"},
+	{"model\\.layers\\.(\\d+)\\.mlp\\.shared_experts\\.(gate|up|down)_proj\\.weight", "blk.$1.ffn_${2}_shexp.weight"},
+	// per head norms are stacked by the model into a single tensor
+	{"model\\.layers\\.(\\d+)\\.self_attn\\.(q|k)_layernorm\\.norms\\.(\\d+)\\.weight", "blk.$1.attn_${2}_norm.$3.weight"},
+
+	// falcon checkpoints name blocks transformer.h or, in older RW
+	// checkpoints, transformer.blocks
+	{"transformer\\.word_embeddings\\.weight", "token_embd.weight"},
+	{"transformer\\.ln_f\\.(weight|bias)", "output_norm.$1"},
+	{"transformer\\.(?:h|blocks)\\.(\\d+)\\.(?:input_layernorm|ln_attn)\\.(weight|bias)", "blk.$1.attn_norm.$2"},
+	{"transformer\\.(?:h|blocks)\\.(\\d+)\\.ln_mlp\\.(weight|bias)", "blk.$1.attn_norm_2.$2"},
+	{"transformer\\.(?:h|blocks)\\.(\\d+)\\.self_attention\\.query_key_value\\.weight", "blk.$1.attn_qkv.weight"},
+	{"transformer\\.(?:h|blocks)\\.(\\d+)\\.self_attention\\.dense\\.weight", "blk.$1.attn_output.weight"},
+	{"transformer\\.(?:h|blocks)\\.(\\d+)\\.mlp\\.dense_h_to_4h\\.weight", "blk.$1.ffn_up.weight"},
+	{"transformer\\.(?:h|blocks)\\.(\\d+)\\.mlp\\.dense_4h_to_h\\.weight", "blk.$1.ffn_down.weight"},
+
+	{"transformer\\.wte\\.weight", "token_embd.weight"},
+	{"transformer\\.norm_f\\.(weight|bias)", "output_norm.$1"},
+	{"transformer\\.blocks\\.(\\d+)\\.norm_1\\.(weight|bias)", "blk.$1.attn_norm.$2"},
+	{"transformer\\.blocks\\.(\\d+)\\.norm_2\\.(weight|bias)", "blk.$1.ffn_norm.$2"},
+	{"transformer\\.blocks\\.(\\d+)\\.attn\\.Wqkv\\.(weight|bias)", "blk.$1.attn_qkv.$2"},
+	{"transformer\\.blocks\\.(\\d+)\\.attn\\.out_proj\\.(weight|bias)", "blk.$1.attn_output.$2"},
+	{"transformer\\.blocks\\.(\\d+)\\.ffn\\.up_proj\\.(weight|bias)", "blk.$1.ffn_up.$2"},
+	{"transformer\\.blocks\\.(\\d+)\\.ffn\\.down_proj\\.(weight|bias)", "blk.$1.ffn_down.$2"},
+
+	{"transformer\\.blocks\\.(\\d+)\\.norm_attn_norm\\.norm_1\\.weight", "blk.$1.attn_norm.weight"},
+	{"transformer\\.blocks\\.(\\d+)\\.norm_attn_norm\\.norm_2\\.weight", "blk.$1.attn_output_norm.weight"},
+	{"transformer\\.blocks\\.(\\d+)\\.norm_attn_norm\\.attn\\.Wqkv\\.weight", "blk.$1.attn_qkv.weight"},
+	{"transformer\\.blocks\\.(\\d+)\\.norm_attn_norm\\.attn\\.out_proj\\.weight", "blk.$1.attn_output.weight"},
+	{"transformer\\.blocks\\.(\\d+)\\.ffn\\.router\\.layer\\.weight", "blk.$1.ffn_gate_inp.weight"},
+	// expert weights are stored fused and without a .weight suffix
+	{"transformer\\.blocks\\.(\\d+)\\.ffn\\.experts\\.mlp\\.w1", "blk.$1.ffn_gate_exps.weight"},
+	{"transformer\\.blocks\\.(\\d+)\\.ffn\\.experts\\.mlp\\.v1", "blk.$1.ffn_up_exps.weight"},
+	{"transformer\\.blocks\\.(\\d+)\\.ffn\\.experts\\.mlp\\.w2", "blk.$1.ffn_down_exps.weight"},
+
+	// gpt2 checkpoints may or may not carry the "transformer." prefix
+	{"(?:transformer\\.)?wte\\.weight", "token_embd.weight"},
+	{"(?:transformer\\.)?wpe\\.weight", "position_embd.weight"},
+	{"(?:transformer\\.)?ln_f\\.(weight|bias)", "output_norm.$1"},
+	{"(?:transformer\\.)?h\\.(\\d+)\\.ln_1\\.(weight|bias)", "blk.$1.attn_norm.$2"},
+	{"(?:transformer\\.)?h\\.(\\d+)\\.attn\\.c_attn\\.(weight|bias)", "blk.$1.attn_qkv.$2"},
+	{"(?:transformer\\.)?h\\.(\\d+)\\.attn\\.c_proj\\.(weight|bias)", "blk.$1.attn_output.$2"},
+	{"(?:transformer\\.)?h\\.(\\d+)\\.ln_2\\.(weight|bias)", "blk.$1.ffn_norm.$2"},
+	{"(?:transformer\\.)?h\\.(\\d+)\\.mlp\\.c_fc\\.(weight|bias)", "blk.$1.ffn_up.$2"},
+	{"(?:transformer\\.)?h\\.(\\d+)\\.mlp\\.c_proj\\.(weight|bias)", "blk.$1.ffn_down.$2"},
+
+	// olmo's layer norms have no weights, so there are none to map
+	{"model\\.transformer\\.wte\\.weight", "token_embd.weight"},
+	{"model\\.transformer\\.ff_out\\.weight", "output.weight"},
+	{"model\\.transformer\\.blocks\\.(\\d+)\\.att_proj\\.weight", "blk.$1.attn_qkv.weight"},
+	{"model\\.transformer\\.blocks\\.(\\d+)\\.attn_out\\.weight", "blk.$1.attn_output.weight"},
+	{"model\\.transformer\\.blocks\\.(\\d+)\\.ff_proj\\.weight", "blk.$1.ffn_up_gate.weight"},
+	{"model\\.transformer\\.blocks\\.(\\d+)\\.ff_out\\.weight", "blk.$1.ffn_down.weight"},
+
+	{"model\\.tok_embeddings\\.weight", "token_embd.weight"},
+	{"output\\.weight", "output.weight"},
+	{"model\\.layers\\.(\\d+)\\.attention_norm\\.weight", "blk.$1.attn_norm.weight"},
+	{"model\\.layers\\.(\\d+)\\.attention\\.wqkv\\.weight", "blk.$1.attn_qkv.weight"},
+	{"model\\.layers\\.(\\d+)\\.attention\\.wo\\.weight", "blk.$1.attn_output.weight"},
+	{"model\\.layers\\.(\\d+)\\.ffn_norm\\.weight", "blk.$1.ffn_norm.weight"},
+	{"model\\.layers\\.(\\d+)\\.feed_forward\\.w1\\.weight", "blk.$1.ffn_gate.weight"},
+	{"model\\.layers\\.(\\d+)\\.feed_forward\\.w2\\.weight", "blk.$1.ffn_down.weight"},
+	{"model\\.layers\\.(\\d+)\\.feed_forward\\.w3\\.weight", "blk.$1.ffn_up.weight"},
+})
+
+type layerName struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+func compileLayerNames(names [][2]string) []layerName {
+	compiled := make([]layerName, len(names))
+	for i, name := range names {
+		compiled[i] = layerName{regexp.MustCompile("^" + name[0] + "$"), name[1]}
+	}
+
+	return compiled
+}
+
 func (m *SafetensorFormat) GetLayerName(n string) (string, error) {
 	directMap := map[string]string{
 		"model.embed_tokens.weight": "token_embd.weight",
@@ -194,9 +374,19 @@ func (m *SafetensorFormat) GetLayerName(n string) (string, error) {
 		}
 	}
 
+	for _, name := range safetensorLayerNames {
+		if name.re.MatchString(n) {
+			return name.re.ReplaceAllString(n, name.repl), nil
+		}
+	}
+
 	return "", fmt.Errorf("couldn't find a layer name for '%s'", n)
 }
 
+// safetensorChunkSize is how many bytes of a tensor are held in memory at
+// once when it's streamed. It's a multiple of every source element size.
+const safetensorChunkSize = 1 << 20
+
 func (r safetensorWriterTo) WriteTo(w io.Writer) (n int64, err error) {
 	f, err := os.Open(r.filename)
 	if err != nil {
@@ -204,61 +394,124 @@ func (r safetensorWriterTo) WriteTo(w io.Writer) (n int64, err error) {
 	}
 	defer f.Close()
 
-	if _, err = f.Seek(r.offset, io.SeekStart); err != nil {
+	sr := io.NewSectionReader(f, r.offset, r.size)
+	if r.repacker == nil {
+		return r.stream(w, sr)
+	}
+
+	// repacking needs the whole tensor
+	bts, err := io.ReadAll(sr)
+	if err != nil {
 		return 0, err
 	}
 
-	var f32s []float32
-	switch r.dtype {
-	case "F32":
-		f32s = make([]float32, r.size/4)
-		if err = binary.Read(f, r.bo, f32s); err != nil {
-			return 0, err
+	if int64(len(bts)) != r.size {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	f32s, err := r.decode(bts)
+	if err != nil {
+		return 0, err
+	}
+
+	f32s, err = r.repacker(r.t.Name, f32s, r.t.Shape)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.encode(w, f32s)
+}
+
+// stream converts the tensor in rd safetensorChunkSize bytes at a time so
+// memory use doesn't grow with the size of the tensor.
+func (r safetensorWriterTo) stream(w io.Writer, rd io.Reader) (n int64, err error) {
+	buf := make([]byte, min(r.size, safetensorChunkSize))
+
+	var read int64
+	for read < r.size {
+		nn, err := io.ReadFull(rd, buf[:min(r.size-read, int64(len(buf)))])
+		read += int64(nn)
+		if err != nil {
+			return n, err
 		}
-	case "F16":
-		u16s := make([]uint16, r.size/2)
-		if err = binary.Read(f, r.bo, u16s); err != nil {
-			return 0, err
+
+		f32s, err := r.decode(buf[:nn])
+		if err != nil {
+			return n, err
 		}
 
-		for _, b := range u16s {
-			f32s = append(f32s, float16.Frombits(b).Float32())
+		written, err := r.encode(w, f32s)
+		n += written
+		if err != nil {
+			return n, err
 		}
+	}
 
-	case "BF16":
-		u8s := make([]uint8, r.size)
-		if err = binary.Read(f, r.bo, u8s); err != nil {
-			return 0, err
+	return n, nil
+}
+
+// decode converts bts, stored as r.dtype, to float32s.
+func (r safetensorWriterTo) decode(bts []byte) ([]float32, error) {
+	switch r.dtype {
+	case "F32":
+		f32s := make([]float32, len(bts)/4)
+		for i := range f32s {
+			f32s[i] = math.Float32frombits(r.bo.Uint32(bts[i*4:]))
 		}
 
-		f32s = bfloat16.DecodeFloat32(u8s)
+		return f32s, nil
+	case "F16":
+		f32s := make([]float32, len(bts)/2)
+		for i := range f32s {
+			f32s[i] = float16.Frombits(r.bo.Uint16(bts[i*2:])).Float32()
+		}
+
+		return f32s, nil
+	case "BF16":
+		return bfloat16.DecodeFloat32(bts), nil
 	default:
-		return 0, fmt.Errorf("unknown data type: %s", r.dtype)
+		return nil, fmt.Errorf("unknown data type: %s", r.dtype)
 	}
+}
 
-	if r.repacker != nil {
-		f32s, err = r.repacker(r.t.Name, f32s, r.t.Shape)
-		if err != nil {
-			return 0, err
-		}
-	}
+// encode writes f32s to w as the tensor's GGML type in the output byte
+// order.
+func (r safetensorWriterTo) encode(w io.Writer, f32s []float32) (int64, error) {
+	bo := r.params.outputByteOrder()
 
+	var bts []byte
 	switch r.t.Kind {
-	case 0:
-		return 0, binary.Write(w, r.bo, f32s)
-	case 1:
-		f16s := make([]uint16, len(f32s))
-		for i := range f32s {
-			f16s[i] = float16.Fromfloat32(f32s[i]).Bits()
+	case tensorKindF32:
+		bts = make([]byte, 0, len(f32s)*4)
+		for _, f := range f32s {
+			bts = bo.AppendUint32(bts, math.Float32bits(f))
+		}
+	case tensorKindF16:
+		bts = make([]byte, 0, len(f32s)*2)
+		for _, f := range f32s {
+			bts = bo.AppendUint16(bts, float16.Fromfloat32(f).Bits())
+		}
+	case tensorKindBF16:
+		bts = bfloat16.EncodeFloat32(f32s)
+		if bo != ByteOrder(binary.LittleEndian) {
+			// bfloat16 only encodes little-endian
+			for i := 0; i < len(bts); i += 2 {
+				bo.PutUint16(bts[i:], binary.LittleEndian.Uint16(bts[i:]))
+			}
 		}
-
-		return 0, binary.Write(w, r.bo, f16s)
 	default:
 		return 0, fmt.Errorf("unknown storage type: %d", r.t.Kind)
 	}
+
+	n, err := w.Write(bts)
+	return int64(n), err
 }
 
 func (m *SafetensorFormat) GetModelArch(name, dirPath string, params *Params) (ModelArch, error) {
+	if err := params.checkRemoteCode(); err != nil {
+		return nil, err
+	}
+
 	switch len(params.Architectures) {
 	case 0:
 		return nil, fmt.Errorf("No architecture specified to convert")
@@ -300,6 +553,161 @@ func (m *SafetensorFormat) GetModelArch(name, dirPath string, params *Params) (M
 					Format: m,
 				},
 			}, nil
+		case "Gemma3ForCausalLM":
+			return &Gemma3Model{
+				GemmaModel{
+					ModelData{
+						Name:   name,
+						Path:   dirPath,
+						Params: params,
+						Format: m,
+					},
+				},
+			}, nil
+		case "FalconForCausalLM", "RWForCausalLM":
+			return &FalconModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "NemotronForCausalLM":
+			return &NemotronModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "StableLmForCausalLM":
+			return &StableLMModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "GPTNeoXForCausalLM":
+			return &GPTNeoXModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "PhiForCausalLM":
+			return &Phi2Model{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "GPT2LMHeadModel":
+			return &GPT2Model{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "Starcoder2ForCausalLM":
+			return &Starcoder2Model{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "BaichuanForCausalLM":
+			return &BaichuanModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "Qwen2MoeForCausalLM":
+			return &Qwen2MoEModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "DeepseekV2ForCausalLM":
+			return &Deepseek2Model{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "CohereForCausalLM", "Cohere2ForCausalLM":
+			return &CohereModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "OLMoForCausalLM":
+			return &OLMoModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "MPTForCausalLM":
+			return &MPTModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "DbrxForCausalLM":
+			return &DBRXModel{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "InternLM2ForCausalLM":
+			return &InternLM2Model{
+				ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
+		case "BertModel", "BertForMaskedLM":
+			return &BertModel{
+				ModelData: ModelData{
+					Name:   name,
+					Path:   dirPath,
+					Params: params,
+					Format: m,
+				},
+			}, nil
 		default:
 			return nil, fmt.Errorf("Models based on '%s' are not yet supported", params.Architectures[0])
 		}
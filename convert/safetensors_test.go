@@ -0,0 +1,160 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/x448/float16"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// countingReader records the largest single read made through it.
+type countingReader struct {
+	io.Reader
+	max int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.max = max(r.max, len(p))
+	return r.Reader.Read(p)
+}
+
+func TestSafetensorStream(t *testing.T) {
+	// a few chunks plus a partial one
+	f32s := make([]float32, safetensorChunkSize/4*3+100)
+	for i := range f32s {
+		f32s[i] = float32(i % 1024)
+	}
+
+	var src bytes.Buffer
+	if err := binary.Write(&src, binary.LittleEndian, f32s); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		kind   uint32
+		expect func() []byte
+	}{
+		{tensorKindF32, func() []byte { return src.Bytes() }},
+		{tensorKindF16, func() []byte {
+			var b bytes.Buffer
+			for _, f := range f32s {
+				binary.Write(&b, binary.LittleEndian, float16.Fromfloat32(f).Bits())
+			}
+			return b.Bytes()
+		}},
+	}
+
+	for _, tt := range cases {
+		r := safetensorWriterTo{
+			t:     &llm.Tensor{Name: "test", Kind: tt.kind, Shape: []uint64{uint64(len(f32s))}},
+			bo:    binary.LittleEndian,
+			dtype: "F32",
+			size:  int64(src.Len()),
+		}
+
+		cr := countingReader{Reader: bytes.NewReader(src.Bytes())}
+
+		var dst bytes.Buffer
+		n, err := r.stream(&dst, &cr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cr.max > safetensorChunkSize {
+			t.Errorf("kind %d: read %d bytes at once, expected at most %d", tt.kind, cr.max, safetensorChunkSize)
+		}
+
+		if n != int64(dst.Len()) {
+			t.Errorf("kind %d: reported %d bytes written, got %d", tt.kind, n, dst.Len())
+		}
+
+		if !bytes.Equal(dst.Bytes(), tt.expect()) {
+			t.Errorf("kind %d: tensor data doesn't match", tt.kind)
+		}
+	}
+
+	t.Run("short", func(t *testing.T) {
+		r := safetensorWriterTo{
+			t:     &llm.Tensor{Name: "test", Kind: tensorKindF32},
+			bo:    binary.LittleEndian,
+			dtype: "F32",
+			size:  int64(src.Len()) + 4,
+		}
+
+		if _, err := r.stream(io.Discard, bytes.NewReader(src.Bytes())); err == nil {
+			t.Error("expected an error reading a truncated tensor")
+		}
+	})
+}
+
+func TestSafetensorHeaderOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	// written out of alphabetical order
+	writeSafetensors(t, dir,
+		safetensor{name: "model.norm.weight", shape: []uint64{4}},
+		safetensor{name: "model.embed_tokens.weight", shape: []uint64{4, 4}},
+		safetensor{name: "lm_head.weight", shape: []uint64{4, 4}},
+	)
+
+	tensors, err := (&SafetensorFormat{}).GetTensors(dir, &Params{ByteOrder: binary.LittleEndian})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	if expect := []string{"output_norm.weight", "token_embd.weight", "output.weight"}; !slices.Equal(names, expect) {
+		t.Errorf("expected %v, got %v", expect, names)
+	}
+
+	var b bytes.Buffer
+	if _, err := tensors[0].WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Len() != 16 {
+		t.Errorf("expected 16 bytes, got %d", b.Len())
+	}
+}
+
+func TestSafetensorLayerName(t *testing.T) {
+	cases := map[string]string{
+		"bert.embeddings.word_embeddings.weight":              "token_embd.weight",
+		"embeddings.word_embeddings.weight":                   "token_embd.weight",
+		"transformer.h.3.self_attention.dense.weight":         "blk.3.attn_output.weight",
+		"h.3.attn.c_attn.bias":                                "blk.3.attn_qkv.bias",
+		"model.layers.2.mlp.experts.7.up_proj.weight":         "blk.2.ffn_up.7.weight",
+		"model.transformer.blocks.0.att_proj.weight":          "blk.0.attn_qkv.weight",
+		"transformer.blocks.1.ffn.experts.mlp.w2":             "blk.1.ffn_down_exps.weight",
+		"model.layers.0.self_attn.q_layernorm.norms.5.weight": "blk.0.attn_q_norm.5.weight",
+	}
+
+	var m SafetensorFormat
+	for name, want := range cases {
+		// look each name up repeatedly since map ordering used to make
+		// overlapping patterns match differently from run to run
+		for range 10 {
+			got, err := m.GetLayerName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != want {
+				t.Fatalf("%s: expected %s, got %s", name, want, got)
+			}
+		}
+	}
+
+	if _, err := m.GetLayerName("model.layers.0.unknown.weight"); err == nil {
+		t.Error("expected an error for an unknown tensor")
+	}
+}
@@ -0,0 +1,123 @@
+package convert
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type StableLMModel struct {
+	ModelData
+}
+
+func (m *StableLMModel) GetTensors() error {
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	re := regexp.MustCompile(`^blk\.(\d+)\.attn_(q|k)_norm\.(\d+)\.weight$`)
+
+	norms := make(map[string][]llm.Tensor)
+	for _, l := range t {
+		if matches := re.FindStringSubmatch(l.Name); matches != nil {
+			name := fmt.Sprintf("blk.%s.attn_%s_norm.weight", matches[1], matches[2])
+			norms[name] = append(norms[name], l)
+			continue
+		}
+
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	if m.Params.QKLayerNorm && len(norms) == 0 {
+		return fmt.Errorf("stablelm: qk_layernorm is set but the checkpoint has no q/k norm tensors")
+	}
+
+	names := make([]string, 0, len(norms))
+	for name := range norms {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		heads := norms[name]
+		if len(heads) != m.Params.AttentionHeads && len(heads) != m.Params.kvHeads() {
+			return fmt.Errorf("stablelm: %s has %d heads", name, len(heads))
+		}
+
+		// names sort lexically so norms.10 would come before norms.2
+		slices.SortFunc(heads, func(a, b llm.Tensor) int {
+			return cmp.Compare(normHead(re, a.Name), normHead(re, b.Name))
+		})
+
+		m.Tensors = append(m.Tensors, llm.Tensor{
+			Name:     name,
+			Kind:     0,
+			Shape:    []uint64{uint64(len(heads)), heads[0].Shape[0]},
+			WriterTo: stackWriterTo(heads),
+		})
+	}
+
+	return nil
+}
+
+func normHead(re *regexp.Regexp, name string) int {
+	n, _ := strconv.Atoi(re.FindStringSubmatch(name)[3])
+	return n
+}
+
+func (m *StableLMModel) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *StableLMModel) WriteGGUF(ws io.WriteSeeker) error {
+	var parallelResidual bool
+	if m.Params.ParallelResidual != nil {
+		parallelResidual = *m.Params.ParallelResidual
+	}
+
+	rotaryFactor := cmp.Or(m.Params.PartialRotaryFactor, 0.25)
+
+	kv := llm.KV{
+		"general.architecture":                  "stablelm",
+		"general.name":                          m.Name,
+		"stablelm.context_length":               uint32(m.Params.ContextSize),
+		"stablelm.embedding_length":             uint32(m.Params.HiddenSize),
+		"stablelm.block_count":                  uint32(m.Params.HiddenLayers),
+		"stablelm.feed_forward_length":          uint32(m.Params.IntermediateSize),
+		"stablelm.rope.dimension_count":         uint32(rotaryFactor * float64(m.Params.headDim())),
+		"stablelm.rope.freq_base":               m.Params.ropeFreqBase(),
+		"stablelm.use_parallel_residual":        parallelResidual,
+		"stablelm.attention.head_count":         uint32(m.Params.AttentionHeads),
+		"stablelm.attention.head_count_kv":      uint32(m.Params.kvHeads()),
+		"stablelm.attention.layer_norm_epsilon": float32(m.Params.LayerNormEPS),
+		"tokenizer.ggml.model":                  "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id": uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id": uint32(m.Params.EoSTokenID),
+	}
+
+	return m.writeGGUF(ws, kv)
+}
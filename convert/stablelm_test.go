@@ -0,0 +1,107 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ollama/ollama/llm"
+)
+
+func testStableLMDir(t *testing.T, qkNorm bool) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":           []string{"StableLmForCausalLM"},
+		"hidden_size":             8,
+		"intermediate_size":       16,
+		"num_hidden_layers":       1,
+		"num_attention_heads":     2,
+		"num_key_value_heads":     2,
+		"max_position_embeddings": 32,
+		"layer_norm_eps":          1e-5,
+		"partial_rotary_factor":   0.5,
+		"use_parallel_residual":   true,
+		"qk_layernorm":            qkNorm,
+	})
+
+	writeBPETokenizer(t, dir)
+
+	ts := []safetensor{
+		{name: "model.embed_tokens.weight", shape: []uint64{4, 8}},
+		{name: "model.layers.0.input_layernorm.weight", shape: []uint64{8}},
+		{name: "model.layers.0.input_layernorm.bias", shape: []uint64{8}},
+		{name: "model.layers.0.self_attn.q_proj.weight", shape: []uint64{8, 8}},
+		{name: "model.layers.0.self_attn.q_proj.bias", shape: []uint64{8}},
+		{name: "model.layers.0.self_attn.k_proj.weight", shape: []uint64{8, 8}},
+		{name: "model.layers.0.self_attn.v_proj.weight", shape: []uint64{8, 8}},
+		{name: "model.layers.0.self_attn.o_proj.weight", shape: []uint64{8, 8}},
+		{name: "model.layers.0.post_attention_layernorm.weight", shape: []uint64{8}},
+		{name: "model.layers.0.post_attention_layernorm.bias", shape: []uint64{8}},
+		{name: "model.layers.0.mlp.gate_proj.weight", shape: []uint64{16, 8}},
+		{name: "model.layers.0.mlp.up_proj.weight", shape: []uint64{16, 8}},
+		{name: "model.layers.0.mlp.down_proj.weight", shape: []uint64{8, 16}},
+		{name: "model.norm.weight", shape: []uint64{8}},
+		{name: "model.norm.bias", shape: []uint64{8}},
+		{name: "lm_head.weight", shape: []uint64{4, 8}},
+	}
+
+	if qkNorm {
+		for _, qk := range []string{"q", "k"} {
+			for h := range 2 {
+				ts = append(ts, safetensor{name: fmt.Sprintf("model.layers.0.self_attn.%s_layernorm.norms.%d.weight", qk, h), shape: []uint64{4}})
+			}
+		}
+	}
+
+	writeSafetensors(t, dir, ts...)
+	return dir
+}
+
+func TestConvertStableLM(t *testing.T) {
+	for _, qkNorm := range []bool{false, true} {
+		t.Run(fmt.Sprintf("qk_layernorm=%t", qkNorm), func(t *testing.T) {
+			kv, tensors := convertDir(t, testStableLMDir(t, qkNorm))
+
+			expect := map[string]any{
+				"general.architecture":                  "stablelm",
+				"stablelm.rope.dimension_count":         uint32(2),
+				"stablelm.use_parallel_residual":        true,
+				"stablelm.attention.head_count_kv":      uint32(2),
+				"stablelm.attention.layer_norm_epsilon": float32(1e-5),
+			}
+
+			for k, v := range expect {
+				if got := kv[k]; got != v {
+					t.Errorf("expected %s %v, got %v", k, v, got)
+				}
+			}
+
+			byName := make(map[string]*llm.Tensor)
+			var names []string
+			for _, t := range tensors {
+				byName[t.Name] = t
+				names = append(names, t.Name)
+			}
+
+			for _, name := range []string{"output_norm.bias", "blk.0.attn_norm.bias", "blk.0.ffn_norm.bias", "blk.0.attn_q.bias"} {
+				if _, ok := byName[name]; !ok {
+					t.Errorf("expected tensor %s, got %v", name, names)
+				}
+			}
+
+			for _, name := range []string{"blk.0.attn_q_norm.weight", "blk.0.attn_k_norm.weight"} {
+				norm, ok := byName[name]
+				if ok != qkNorm {
+					t.Fatalf("expected %s present=%t, got %v", name, qkNorm, names)
+				}
+
+				// ggml lists dimensions innermost first
+				if ok && !slices.Equal(norm.Shape[:2], []uint64{4, 2}) {
+					t.Errorf("expected %s shape [4 2], got %v", name, norm.Shape)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package convert
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/llm"
+)
+
+type Starcoder2Model struct {
+	ModelData
+}
+
+func (m *Starcoder2Model) GetTensors() error {
+	// starcoder2 uses neox style rotary embeddings so unlike llama q and k
+	// don't need repacking
+	t, err := m.Format.GetTensors(m.Path, m.Params)
+	if err != nil {
+		return err
+	}
+
+	// with grouped-query attention the k and v biases are only as long as
+	// the key/value heads, not the hidden size
+	kvSize := uint64(m.Params.kvHeads() * m.Params.headDim())
+	for _, l := range t {
+		if strings.HasSuffix(l.Name, "attn_k.bias") || strings.HasSuffix(l.Name, "attn_v.bias") {
+			if len(l.Shape) != 1 || l.Shape[0] != kvSize {
+				return fmt.Errorf("%s: shape %v doesn't match %d key/value heads of %d", l.Name, l.Shape, m.Params.kvHeads(), m.Params.headDim())
+			}
+		}
+
+		m.Tensors = append(m.Tensors, l)
+	}
+
+	return nil
+}
+
+func (m *Starcoder2Model) LoadVocab() error {
+	_, ts, merges, err := parseTokens(filepath.Join(m.Path, "tokenizer.json"))
+	if err != nil {
+		return err
+	}
+
+	m.Vocab = &Vocab{}
+	for _, t := range ts {
+		m.Vocab.Tokens = append(m.Vocab.Tokens, t.Content)
+		m.Vocab.Types = append(m.Vocab.Types, t.Type())
+	}
+
+	m.Vocab.Merges = merges
+	return nil
+}
+
+func (m *Starcoder2Model) WriteGGUF(ws io.WriteSeeker) error {
+	kv := llm.KV{
+		"general.architecture":               "starcoder2",
+		"general.name":                       m.Name,
+		"starcoder2.context_length":          uint32(m.Params.ContextSize),
+		"starcoder2.embedding_length":        uint32(m.Params.HiddenSize),
+		"starcoder2.block_count":             uint32(m.Params.HiddenLayers),
+		"starcoder2.feed_forward_length":     uint32(m.Params.IntermediateSize),
+		"starcoder2.rope.freq_base":          m.Params.ropeFreqBase(),
+		"starcoder2.attention.head_count":    uint32(m.Params.AttentionHeads),
+		"starcoder2.attention.head_count_kv": uint32(m.Params.kvHeads()),
+		// starcoder2 norms are LayerNorms with a bias rather than RMS norms
+		"starcoder2.attention.layer_norm_epsilon": float32(cmp.Or(m.Params.NormEpsilon, 1e-5)),
+		"tokenizer.ggml.model":                    "gpt2",
+
+		"tokenizer.ggml.tokens":     m.Vocab.Tokens,
+		"tokenizer.ggml.token_type": m.Vocab.Types,
+		"tokenizer.ggml.merges":     m.Vocab.Merges,
+
+		"tokenizer.ggml.bos_token_id":  uint32(m.Params.BoSTokenID),
+		"tokenizer.ggml.eos_token_id":  uint32(m.Params.EoSTokenID),
+		"tokenizer.ggml.add_bos_token": false,
+	}
+
+	if m.Params.SlidingWindow > 0 {
+		kv["starcoder2.attention.sliding_window"] = uint32(m.Params.SlidingWindow)
+	}
+
+	return m.writeGGUF(ws, kv)
+}
@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"slices"
+	"testing"
+)
+
+func starcoder2Tensors(kvSize uint64) []safetensor {
+	var ts []safetensor
+	for _, tt := range []struct {
+		name  string
+		shape []uint64
+	}{
+		{"model.layers.0.input_layernorm", []uint64{8}},
+		{"model.layers.0.self_attn.q_proj", []uint64{8, 8}},
+		{"model.layers.0.self_attn.k_proj", []uint64{kvSize, 8}},
+		{"model.layers.0.self_attn.v_proj", []uint64{kvSize, 8}},
+		{"model.layers.0.self_attn.o_proj", []uint64{8, 8}},
+		{"model.layers.0.post_attention_layernorm", []uint64{8}},
+		{"model.layers.0.mlp.c_fc", []uint64{32, 8}},
+		{"model.layers.0.mlp.c_proj", []uint64{8, 32}},
+		{"model.norm", []uint64{8}},
+	} {
+		ts = append(ts,
+			safetensor{name: tt.name + ".weight", shape: tt.shape},
+			safetensor{name: tt.name + ".bias", shape: tt.shape[:1]},
+		)
+	}
+
+	return append(ts, safetensor{name: "model.embed_tokens.weight", shape: []uint64{4, 8}})
+}
+
+func TestConvertStarcoder2(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":           []string{"Starcoder2ForCausalLM"},
+		"hidden_size":             8,
+		"intermediate_size":       32,
+		"num_hidden_layers":       1,
+		"num_attention_heads":     4,
+		"num_key_value_heads":     2,
+		"max_position_embeddings": 16384,
+		"norm_epsilon":            1e-5,
+		"rope_theta":              100000,
+		"sliding_window":          4096,
+		"use_bias":                true,
+	})
+
+	writeBPETokenizer(t, dir)
+
+	// 2 key/value heads of 2
+	writeSafetensors(t, dir, starcoder2Tensors(4)...)
+
+	kv, tensors := convertDir(t, dir)
+
+	for k, v := range map[string]any{
+		"general.architecture":                    "starcoder2",
+		"starcoder2.context_length":               uint32(16384),
+		"starcoder2.embedding_length":             uint32(8),
+		"starcoder2.feed_forward_length":          uint32(32),
+		"starcoder2.block_count":                  uint32(1),
+		"starcoder2.rope.freq_base":               float32(100000),
+		"starcoder2.attention.head_count":         uint32(4),
+		"starcoder2.attention.head_count_kv":      uint32(2),
+		"starcoder2.attention.layer_norm_epsilon": float32(1e-5),
+		"starcoder2.attention.sliding_window":     uint32(4096),
+	} {
+		if got := kv[k]; got != v {
+			t.Errorf("expected %s %v, got %v", k, v, got)
+		}
+	}
+
+	shapes := make(map[string][]uint64)
+	for _, t := range tensors {
+		shapes[t.Name] = t.Shape
+	}
+
+	// decoded shapes are reversed and padded to four dimensions
+	for name, shape := range map[string][]uint64{
+		"token_embd.weight":      {8, 4},
+		"blk.0.attn_norm.bias":   {8},
+		"blk.0.attn_q.bias":      {8},
+		"blk.0.attn_k.weight":    {8, 4},
+		"blk.0.attn_k.bias":      {4},
+		"blk.0.attn_v.bias":      {4},
+		"blk.0.attn_output.bias": {8},
+		"blk.0.ffn_norm.bias":    {8},
+		"blk.0.ffn_up.weight":    {8, 32},
+		"blk.0.ffn_up.bias":      {32},
+		"blk.0.ffn_down.weight":  {32, 8},
+		"blk.0.ffn_down.bias":    {8},
+		"output_norm.weight":     {8},
+		"output_norm.bias":       {8},
+	} {
+		if got, ok := shapes[name]; !ok {
+			t.Errorf("missing tensor %s", name)
+		} else if !slices.Equal(got[:len(shape)], shape) {
+			t.Errorf("expected %s shape %v, got %v", name, shape, got[:len(shape)])
+		}
+	}
+
+	t.Run("kv bias mismatch", func(t *testing.T) {
+		dir := t.TempDir()
+		writeJSON(t, dir, "config.json", map[string]any{
+			"architectures":       []string{"Starcoder2ForCausalLM"},
+			"hidden_size":         8,
+			"num_attention_heads": 4,
+			"num_key_value_heads": 2,
+		})
+
+		writeBPETokenizer(t, dir)
+		writeSafetensors(t, dir, starcoder2Tensors(8)...)
+
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := arch.GetTensors(); err == nil {
+			t.Error("expected an error for k and v biases sized for every head")
+		}
+	})
+}
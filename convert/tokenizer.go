@@ -64,7 +64,7 @@ func (t *Tokenizer) maxID() int {
 func parseTokens(dirpath string) (pre string, tokens []Token, merges []string, err error) {
 	f, err := os.Open(dirpath)
 	if err != nil {
-		panic(err)
+		return "", nil, nil, err
 	}
 	defer f.Close()
 
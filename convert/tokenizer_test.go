@@ -0,0 +1,112 @@
+package convert
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ollama/ollama/convert/sentencepiece"
+)
+
+type spmPiece struct {
+	piece string
+	score float32
+	typ   sentencepiece.ModelProto_SentencePiece_Type
+}
+
+func writeSentencePieceModel(t *testing.T, dir string, pieces ...spmPiece) {
+	t.Helper()
+
+	var mp sentencepiece.ModelProto
+	for _, p := range pieces {
+		mp.Pieces = append(mp.Pieces, &sentencepiece.ModelProto_SentencePiece{
+			Piece: proto.String(p.piece),
+			Score: proto.Float32(p.score),
+			Type:  p.typ.Enum(),
+		})
+	}
+
+	bts, err := proto.Marshal(&mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tokenizer.model"), bts, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var testSentencePieces = []spmPiece{
+	{"<unk>", 0, sentencepiece.ModelProto_SentencePiece_UNKNOWN},
+	{"<s>", 0, sentencepiece.ModelProto_SentencePiece_CONTROL},
+	{"</s>", 0, sentencepiece.ModelProto_SentencePiece_CONTROL},
+	{"▁a", -1.5, sentencepiece.ModelProto_SentencePiece_NORMAL},
+	{"b", -2.25, sentencepiece.ModelProto_SentencePiece_NORMAL},
+	{"<0x0A>", 0, sentencepiece.ModelProto_SentencePiece_BYTE},
+}
+
+func TestLoadSentencePieceTokens(t *testing.T) {
+	dir := t.TempDir()
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+
+	v, err := LoadSentencePieceTokens(dir, &Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(v.Tokens, []string{"<unk>", "<s>", "</s>", "▁a", "b", "<0x0A>"}) {
+		t.Errorf("unexpected tokens %v", v.Tokens)
+	}
+
+	if !slices.Equal(v.Scores, []float32{0, 0, 0, -1.5, -2.25, 0}) {
+		t.Errorf("unexpected scores %v", v.Scores)
+	}
+
+	if !slices.Equal(v.Types, []int32{2, 3, 3, 1, 1, 6}) {
+		t.Errorf("unexpected types %v", v.Types)
+	}
+}
+
+func TestConvertLlamaSentencePiece(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":       []string{"LlamaForCausalLM"},
+		"hidden_size":         4,
+		"num_attention_heads": 1,
+		"rms_norm_eps":        1e-5,
+	})
+
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+
+	writeSafetensors(t, dir,
+		safetensor{name: "model.embed_tokens.weight", shape: []uint64{6, 4}},
+		safetensor{name: "model.norm.weight", shape: []uint64{4}},
+		safetensor{name: "lm_head.weight", shape: []uint64{6, 4}},
+	)
+
+	kv, _ := convertDir(t, dir)
+
+	if got := kv["tokenizer.ggml.model"]; got != "llama" {
+		t.Errorf("expected tokenizer model llama, got %v", got)
+	}
+
+	if _, ok := kv["tokenizer.ggml.merges"]; ok {
+		t.Error("unexpected merges for sentencepiece vocab")
+	}
+
+	for k, v := range map[string]any{
+		"tokenizer.ggml.scores":     []float32{0, 0, 0, -1.5, -2.25, 0},
+		"tokenizer.ggml.token_type": []int32{2, 3, 3, 1, 1, 6},
+	} {
+		// decoded arrays use an unexported type so compare their encodings
+		want, _ := json.Marshal(v)
+		got, _ := json.Marshal(kv[k])
+		if string(got) != string(want) {
+			t.Errorf("expected %s %s, got %s", k, want, got)
+		}
+	}
+}
@@ -22,7 +22,6 @@ type torchWriterTo struct {
 	t *llm.Tensor
 
 	params *Params
-	bo     ByteOrder
 
 	storage  pytorch.StorageInterface
 	repacker func(string, []float32, []uint64) ([]float32, error)
@@ -42,6 +41,12 @@ func (tf *TorchFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor,
 
 	var offset uint64
 	var tensors []llm.Tensor
+	renamer := params.renamer()
+	skipper, err := params.skipper()
+	if err != nil {
+		return nil, err
+	}
+
 	for _, fn := range files {
 		m, err := pytorch.Load(fn)
 		if err != nil {
@@ -54,6 +59,10 @@ func (tf *TorchFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor,
 				continue
 			}
 
+			if skipper.skipped(k.(string)) {
+				continue
+			}
+
 			t, _ := m.(*types.Dict).Get(k)
 			tshape := t.(*pytorch.Tensor).Size
 
@@ -72,7 +81,12 @@ func (tf *TorchFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor,
 				size = uint64(tshape[0] * tshape[1] * 2)
 			}
 
-			ggufName, err := tf.GetLayerName(k.(string))
+			renamed, err := renamer.rename(k.(string))
+			if err != nil {
+				return nil, err
+			}
+
+			ggufName, err := tf.GetLayerName(renamed)
 			if err != nil {
 				slog.Error(err.Error())
 				return nil, err
@@ -94,7 +108,6 @@ func (tf *TorchFormat) GetTensors(dirpath string, params *Params) ([]llm.Tensor,
 			tensor.WriterTo = torchWriterTo{
 				t:       &tensor,
 				params:  params,
-				bo:      params.ByteOrder,
 				storage: t.(*pytorch.Tensor).Source,
 			}
 
@@ -250,20 +263,24 @@ func (r torchWriterTo) WriteTo(w io.Writer) (n int64, err error) {
 
 	switch r.t.Kind {
 	case 0:
-		return 0, binary.Write(w, r.bo, f32s)
+		return 0, binary.Write(w, r.params.outputByteOrder(), f32s)
 	case 1:
 		f16s := make([]uint16, len(f32s))
 		for i := range f32s {
 			f16s[i] = float16.Fromfloat32(f32s[i]).Bits()
 		}
 
-		return 0, binary.Write(w, r.bo, f16s)
+		return 0, binary.Write(w, r.params.outputByteOrder(), f16s)
 	default:
 		return 0, fmt.Errorf("unknown storage type: %d", r.t.Kind)
 	}
 }
 
 func (m *TorchFormat) GetModelArch(name, dirPath string, params *Params) (ModelArch, error) {
+	if err := params.checkRemoteCode(); err != nil {
+		return nil, err
+	}
+
 	switch len(params.Architectures) {
 	case 0:
 		return nil, fmt.Errorf("No architecture specified to convert")
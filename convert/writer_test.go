@@ -0,0 +1,1223 @@
+package convert
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/d4l3k/go-bfloat16"
+	"github.com/x448/float16"
+
+	"github.com/ollama/ollama/llm"
+)
+
+// writeAndDecode writes arch to a temporary GGUF and decodes it again.
+func writeAndDecode(t *testing.T, arch ModelArch) (llm.KV, llm.Tensors) {
+	t.Helper()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "model.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := arch.WriteGGUF(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _, err := llm.DecodeGGML(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m.KV(), m.Tensors()
+}
+
+// safetensor describes an F32 tensor for writeSafetensors. A nil data is
+// written as zeros.
+type safetensor struct {
+	name  string
+	shape []uint64
+	data  []float32
+	// dtype defaults to F32
+	dtype string
+}
+
+// writeSafetensors writes ts to a model.safetensors in dir.
+func writeSafetensors(t *testing.T, dir string, ts ...safetensor) {
+	t.Helper()
+
+	header := make(map[string]safetensorMetadata)
+	var data bytes.Buffer
+	for _, st := range ts {
+		n := uint64(1)
+		for _, dim := range st.shape {
+			n *= dim
+		}
+
+		f32s := st.data
+		if f32s == nil {
+			f32s = make([]float32, n)
+		}
+
+		dtype := cmp.Or(st.dtype, "F32")
+
+		start := int64(data.Len())
+		switch dtype {
+		case "F32":
+			if err := binary.Write(&data, binary.LittleEndian, f32s); err != nil {
+				t.Fatal(err)
+			}
+		case "F16":
+			for _, f := range f32s {
+				if err := binary.Write(&data, binary.LittleEndian, float16.Fromfloat32(f).Bits()); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case "BF16":
+			data.Write(bfloat16.EncodeFloat32(f32s))
+		default:
+			t.Fatalf("unsupported dtype %s", dtype)
+		}
+
+		header[st.name] = safetensorMetadata{
+			Type:    dtype,
+			Shape:   st.shape,
+			Offsets: []int64{start, int64(data.Len())},
+		}
+	}
+
+	bts, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, int64(len(bts))); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Write(bts)
+	b.Write(data.Bytes())
+
+	if err := os.WriteFile(filepath.Join(dir, "model.safetensors"), b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeJSON marshals v to name in dir, creating parent directories.
+func writeJSON(t *testing.T, dir, name string, v any) {
+	t.Helper()
+
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	bts, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, bts, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeBPETokenizer writes a tokenizer.json with a four token BPE vocabulary.
+func writeBPETokenizer(t *testing.T, dir string) {
+	t.Helper()
+
+	writeJSON(t, dir, "tokenizer.json", map[string]any{
+		"added_tokens": []map[string]any{
+			{"id": 0, "content": "<|endoftext|>", "special": true},
+		},
+		"model": map[string]any{
+			"type":   "BPE",
+			"vocab":  map[string]int{"<|endoftext|>": 0, "a": 1, "b": 2, "ab": 3},
+			"merges": []string{"a b"},
+		},
+	})
+}
+
+// convertDir runs the full conversion pipeline over a checkpoint in dir.
+func convertDir(t *testing.T, dir string) (llm.KV, llm.Tensors) {
+	t.Helper()
+
+	mf, err := GetModelFormat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := mf.GetParams(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arch, err := mf.GetModelArch("test", dir, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arch.GetTensors(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arch.LoadVocab(); err != nil {
+		t.Fatal(err)
+	}
+
+	return writeAndDecode(t, arch)
+}
+
+func testGemmaModel(params *Params) *GemmaModel {
+	params.ByteOrder = binary.LittleEndian
+	return &GemmaModel{
+		ModelData{
+			Name:   "test",
+			Params: params,
+			Vocab: &Vocab{
+				Tokens: []string{"<pad>", "<eos>", "<bos>", "<unk>"},
+				Scores: []float32{0, 0, 0, 0},
+				Types:  []int32{tokenTypeControl, tokenTypeControl, tokenTypeControl, tokenTypeUnknown},
+			},
+		},
+	}
+}
+
+func TestWriteGGUFKVHeadsDefault(t *testing.T) {
+	// num_key_value_heads is left out of the config
+	params := func() *Params {
+		return &Params{
+			ContextSize:    8192,
+			HiddenSize:     2048,
+			HiddenLayers:   18,
+			AttentionHeads: 8,
+		}
+	}
+
+	llama := testGemmaModel(params()).ModelData
+	for arch, m := range map[string]ModelArch{
+		"gemma": testGemmaModel(params()),
+		"llama": &LlamaModel{llama},
+	} {
+		t.Run(arch, func(t *testing.T) {
+			kv, _ := writeAndDecode(t, m)
+
+			if got := kv[arch+".attention.head_count_kv"]; got != uint32(8) {
+				t.Errorf("expected %s.attention.head_count_kv to equal head_count 8, got %v", arch, got)
+			}
+		})
+	}
+}
+
+func TestWriteGGUFOverrides(t *testing.T) {
+	var b bytes.Buffer
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&b, nil)))
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	m := testGemmaModel(&Params{
+		ContextSize:    8192,
+		HiddenSize:     2048,
+		HiddenLayers:   18,
+		AttentionHeads: 8,
+		KeyValHeads:    1,
+		HeadDimension:  256,
+		Overrides: map[string]any{
+			"gemma.context_length": 16384.0,
+			"general.source":       "test",
+		},
+	})
+
+	kv, _ := writeAndDecode(t, m)
+
+	if got := kv.ContextLength(); got != 16384 {
+		t.Errorf("expected context length 16384, got %d", got)
+	}
+
+	if got := kv["general.source"]; got != "test" {
+		t.Errorf("expected general.source test, got %v", got)
+	}
+
+	if !strings.Contains(b.String(), "general.source") {
+		t.Errorf("expected warning for unknown key, got %q", b.String())
+	}
+}
+
+func TestCoerceKV(t *testing.T) {
+	cases := []struct {
+		want, value, expect any
+	}{
+		{uint8(0), 255, uint8(255)},
+		{int8(0), "-128", int8(-128)},
+		{uint16(0), 65535.0, uint16(65535)},
+		{int16(0), int64(-32768), int16(-32768)},
+		{uint32(0), 4096.0, uint32(4096)},
+		{uint32(0), "4096", uint32(4096)},
+		{int32(0), -1, int32(-1)},
+		{int32(0), "2147483647", int32(math.MaxInt32)},
+		{uint64(0), 6_738_415_616, uint64(6_738_415_616)},
+		{uint64(0), "18446744073709551615", uint64(math.MaxUint64)},
+		{int64(0), "-9223372036854775808", int64(math.MinInt64)},
+		{int64(0), uint32(7), int64(7)},
+		{float32(0), 1e-5, float32(1e-5)},
+		{float64(0), "0.1", 0.1},
+		{true, "false", false},
+		{"", "name", "name"},
+		{[]string{}, []string{"a"}, []string{"a"}},
+	}
+
+	for _, tt := range cases {
+		got, err := coerceKV(tt.want, tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !equalKV(got, tt.expect) {
+			t.Errorf("coerceKV(%T, %v): expected %T(%v), got %T(%v)", tt.want, tt.value, tt.expect, tt.expect, got, got)
+		}
+	}
+
+	invalid := []struct {
+		want, value any
+	}{
+		{uint8(0), 256},
+		{int8(0), 128},
+		{uint16(0), -1},
+		{int16(0), "40000"},
+		{uint32(0), -1.0},
+		{uint32(0), 1.5},
+		{uint32(0), "abc"},
+		{uint32(0), 6_738_415_616},
+		{int32(0), int64(math.MaxInt32) + 1},
+		{uint64(0), -1},
+		{int64(0), uint64(math.MaxUint64)},
+		{true, 1},
+	}
+
+	for _, tt := range invalid {
+		if _, err := coerceKV(tt.want, tt.value); err == nil {
+			t.Errorf("expected error coercing %v to %T", tt.value, tt.want)
+		}
+	}
+}
+
+func TestKVType(t *testing.T) {
+	cases := []struct {
+		value, expect any
+	}{
+		{4096, uint32(0)},
+		{uint64(math.MaxUint32) + 1, uint64(0)},
+		{-1, int32(0)},
+		{int64(math.MinInt32) - 1, int64(0)},
+		{0.5, float32(0)},
+		{"name", "name"},
+	}
+
+	for _, tt := range cases {
+		if got := kvType(tt.value); got != tt.expect {
+			t.Errorf("kvType(%v): expected %T, got %T", tt.value, tt.expect, got)
+		}
+	}
+}
+
+func equalKV(a, b any) bool {
+	if as, ok := a.([]string); ok {
+		bs, ok := b.([]string)
+		return ok && strings.Join(as, ",") == strings.Join(bs, ",")
+	}
+
+	return a == b
+}
+
+type zeroWriterTo struct {
+	size uint64
+}
+
+func (w zeroWriterTo) WriteTo(ww io.Writer) (int64, error) {
+	n, err := ww.Write(make([]byte, w.size))
+	return int64(n), err
+}
+
+// testTensor returns an F32 tensor with the given shape filled with zeros.
+func testTensor(name string, shape ...uint64) llm.Tensor {
+	t := llm.Tensor{Name: name, Kind: 0, Shape: shape}
+	t.WriterTo = zeroWriterTo{size: t.Size()}
+	return t
+}
+
+func testLlamaModel(params *Params, tensors ...llm.Tensor) *LlamaModel {
+	params.ByteOrder = binary.LittleEndian
+	return &LlamaModel{
+		ModelData{
+			Name:   "test",
+			Params: params,
+			Vocab: &Vocab{
+				Tokens: []string{"<s>", "</s>", "a", "b"},
+				Scores: []float32{0, 0, 0, 0},
+				Types:  []int32{tokenTypeControl, tokenTypeControl, tokenTypeNormal, tokenTypeNormal},
+			},
+			Tensors: tensors,
+		},
+	}
+}
+
+func TestWriteGGUFTiedEmbeddings(t *testing.T) {
+	for _, tied := range []bool{true, false} {
+		t.Run(fmt.Sprintf("tied=%t", tied), func(t *testing.T) {
+			m := testLlamaModel(&Params{
+				HiddenSize:        8,
+				HiddenLayers:      1,
+				AttentionHeads:    2,
+				KeyValHeads:       2,
+				TieWordEmbeddings: tied,
+			},
+				testTensor("token_embd.weight", 8, 4),
+				testTensor("output.weight", 8, 4),
+				testTensor("output_norm.weight", 8),
+			)
+
+			_, tensors := writeAndDecode(t, m)
+
+			var names []string
+			for _, t := range tensors {
+				names = append(names, t.Name)
+			}
+
+			expect := 3
+			if tied {
+				expect = 2
+			}
+
+			if len(names) != expect {
+				t.Fatalf("expected %d tensors, got %v", expect, names)
+			}
+
+			if tied && slices.Contains(names, "output.weight") {
+				t.Errorf("expected output.weight to be omitted, got %v", names)
+			}
+		})
+	}
+}
+
+func TestWriteGGUFPadVocab(t *testing.T) {
+	cases := []struct {
+		vocab, pad, rows uint64
+	}{
+		// 32000 is already a multiple of 256 so only the size is recorded
+		{vocab: 32000, pad: 256, rows: 32000},
+		{vocab: 32000, pad: 384, rows: 32256},
+		{vocab: 32003, pad: 256, rows: 32256},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("%d to %d", tt.vocab, tt.pad), func(t *testing.T) {
+			m := testGemmaModel(&Params{
+				HiddenSize:     8,
+				HiddenLayers:   1,
+				AttentionHeads: 2,
+				KeyValHeads:    2,
+				PadVocabTo:     int(tt.pad),
+			})
+			m.Tensors = []llm.Tensor{
+				testTensor("token_embd.weight", tt.vocab, 8),
+				testTensor("output.weight", tt.vocab, 8),
+				testTensor("output_norm.weight", 8),
+			}
+
+			kv, tensors := writeAndDecode(t, m)
+
+			if got := kv["gemma.vocab_size"]; got != uint32(tt.vocab) {
+				t.Errorf("expected vocab_size %d, got %v", tt.vocab, got)
+			}
+
+			// decoded shapes are reversed
+			for _, tensor := range tensors {
+				switch tensor.Name {
+				case "token_embd.weight", "output.weight":
+					if tensor.Shape[1] != tt.rows {
+						t.Errorf("expected %s to have %d rows, got %d", tensor.Name, tt.rows, tensor.Shape[1])
+					}
+				case "output_norm.weight":
+					if tensor.Shape[0] != 8 {
+						t.Errorf("expected output_norm.weight to be unpadded, got %v", tensor.Shape)
+					}
+				}
+			}
+
+			// the original tensors aren't changed
+			if m.Tensors[0].Shape[0] != tt.vocab {
+				t.Errorf("expected the model's token_embd.weight to keep %d rows, got %d", tt.vocab, m.Tensors[0].Shape[0])
+			}
+		})
+	}
+
+	t.Run("zero rows", func(t *testing.T) {
+		tensor := llm.Tensor{Name: "token_embd.weight", Kind: 0, Shape: []uint64{3, 2}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{0xff}, 24))}
+		ts := padVocab(llm.KV{"general.architecture": "llama"}, []llm.Tensor{tensor}, 4)
+
+		var b bytes.Buffer
+		if _, err := ts[0].WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+
+		want := append(bytes.Repeat([]byte{0xff}, 24), make([]byte, 8)...)
+		if !bytes.Equal(b.Bytes(), want) {
+			t.Errorf("expected the padded row to be zeros, got %v", b.Bytes())
+		}
+	})
+}
+
+func TestHeadDimFallback(t *testing.T) {
+	cases := []struct {
+		name    string
+		headDim int
+		expect  uint32
+	}{
+		{"explicit", 256, 256},
+		{"derived", 0, 2048 / 8},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testGemmaModel(&Params{
+				HiddenSize:     2048,
+				HiddenLayers:   18,
+				AttentionHeads: 8,
+				KeyValHeads:    1,
+				HeadDimension:  tt.headDim,
+			})
+
+			kv, _ := writeAndDecode(t, m)
+
+			for _, k := range []string{"gemma.attention.key_length", "gemma.attention.value_length"} {
+				if got := kv[k]; got != tt.expect {
+					t.Errorf("expected %s %d, got %v", k, tt.expect, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteGGUFSourceMetadata(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":  []string{"GemmaForCausalLM"},
+		"hidden_size":    2048,
+		"_custom_field":  "custom",
+		"_custom_number": 7,
+		"_custom_bool":   true,
+		"nested":         map[string]any{"a": 1},
+	})
+
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%t", enabled), func(t *testing.T) {
+			m := testGemmaModel(&Params{
+				HiddenSize:     2048,
+				HiddenLayers:   1,
+				AttentionHeads: 8,
+				SourceMetadata: enabled,
+			})
+			m.Path = dir
+
+			kv, _ := writeAndDecode(t, m)
+
+			expect := map[string]any{
+				"general.source._custom_field":  "custom",
+				"general.source._custom_number": uint32(7),
+				"general.source._custom_bool":   true,
+			}
+
+			for k, v := range expect {
+				if got, ok := kv[k]; enabled && got != v {
+					t.Errorf("expected %s %v, got %v", k, v, got)
+				} else if !enabled && ok {
+					t.Errorf("expected %s to be omitted, got %v", k, got)
+				}
+			}
+
+			for k := range kv {
+				if k == "general.source.nested" || strings.HasPrefix(k, "general.source.nested.") || k == "general.source.hidden_size" {
+					t.Errorf("unexpected key %s", k)
+				}
+			}
+		})
+	}
+}
+
+func TestRopeFreqBase(t *testing.T) {
+	cases := []struct {
+		name   string
+		theta  float64
+		expect float32
+	}{
+		{"yi", 5000000, 5000000},
+		{"default", 0, 10000},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			llama := testLlamaModel(&Params{
+				HiddenSize:        8,
+				HiddenLayers:      1,
+				AttentionHeads:    2,
+				RopeFrequencyBase: tt.theta,
+			})
+
+			if kv, _ := writeAndDecode(t, llama); kv["llama.rope.freq_base"] != tt.expect {
+				t.Errorf("expected llama.rope.freq_base %v, got %v", tt.expect, kv["llama.rope.freq_base"])
+			}
+
+			gemma := testGemmaModel(&Params{
+				HiddenSize:        8,
+				HiddenLayers:      1,
+				AttentionHeads:    2,
+				RopeFrequencyBase: tt.theta,
+			})
+
+			if kv, _ := writeAndDecode(t, gemma); kv["gemma.rope.freq_base"] != tt.expect {
+				t.Errorf("expected gemma.rope.freq_base %v, got %v", tt.expect, kv["gemma.rope.freq_base"])
+			}
+		})
+	}
+}
+
+func TestWriteGGUFVerify(t *testing.T) {
+	m := testGemmaModel(&Params{
+		HiddenSize:     4,
+		HiddenLayers:   1,
+		AttentionHeads: 1,
+		Verify:         true,
+	})
+	m.Tensors = []llm.Tensor{
+		testTensor("token_embd.weight", 4, 4),
+		testTensor("output_norm.weight", 4),
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "model.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := m.WriteGGUF(f); err != nil {
+		t.Fatal(err)
+	}
+
+	kv := llm.KV{
+		"general.architecture":   "gemma",
+		"gemma.embedding_length": uint32(4),
+		"gemma.block_count":      uint32(1),
+	}
+
+	if err := verifyGGUF(f, kv, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("tensors", func(t *testing.T) {
+		if err := verifyGGUF(f, kv, 3); err == nil {
+			t.Error("expected tensor count mismatch")
+		}
+	})
+
+	t.Run("kv", func(t *testing.T) {
+		kv := maps.Clone(kv)
+		kv["gemma.block_count"] = uint32(2)
+		if err := verifyGGUF(f, kv, 2); err == nil {
+			t.Error("expected block count mismatch")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := f.Truncate(fi.Size() - 8); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := verifyGGUF(f, kv, 2); err == nil || !strings.Contains(err.Error(), "truncated") {
+			t.Errorf("expected truncated error, got %v", err)
+		}
+	})
+}
+
+func TestConvertMixedPrecision(t *testing.T) {
+	newDir := func(t *testing.T) string {
+		dir := t.TempDir()
+		writeJSON(t, dir, "config.json", map[string]any{
+			"architectures":       []string{"LlamaForCausalLM"},
+			"hidden_size":         4,
+			"num_attention_heads": 1,
+			"rms_norm_eps":        1e-5,
+		})
+
+		writeBPETokenizer(t, dir)
+
+		writeSafetensors(t, dir,
+			safetensor{name: "model.embed_tokens.weight", shape: []uint64{4, 4}, dtype: "F32"},
+			safetensor{name: "model.norm.weight", shape: []uint64{4}, dtype: "F16"},
+			safetensor{name: "lm_head.weight", shape: []uint64{4, 4}, dtype: "F16"},
+			safetensor{name: "model.layers.0.mlp.down_proj.weight", shape: []uint64{4, 4}, dtype: "BF16"},
+		)
+
+		return dir
+	}
+
+	cases := []struct {
+		outputType string
+		fileType   uint32
+		kinds      map[string]uint32
+	}{
+		{
+			fileType: 1,
+			kinds: map[string]uint32{
+				"token_embd.weight":     tensorKindF32,
+				"output_norm.weight":    tensorKindF32,
+				"output.weight":         tensorKindF16,
+				"blk.0.ffn_down.weight": tensorKindBF16,
+			},
+		},
+		{
+			outputType: "F16",
+			fileType:   1,
+			kinds: map[string]uint32{
+				"token_embd.weight":     tensorKindF16,
+				"output_norm.weight":    tensorKindF32,
+				"output.weight":         tensorKindF16,
+				"blk.0.ffn_down.weight": tensorKindF16,
+			},
+		},
+		{
+			outputType: "F32",
+			fileType:   0,
+			kinds: map[string]uint32{
+				"token_embd.weight":     tensorKindF32,
+				"output_norm.weight":    tensorKindF32,
+				"output.weight":         tensorKindF32,
+				"blk.0.ffn_down.weight": tensorKindF32,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(cmp.Or(tt.outputType, "source"), func(t *testing.T) {
+			dir := newDir(t)
+
+			mf, err := GetModelFormat(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			params, err := mf.GetParams(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params.OutputType = tt.outputType
+
+			arch, err := mf.GetModelArch("test", dir, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := arch.GetTensors(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := arch.LoadVocab(); err != nil {
+				t.Fatal(err)
+			}
+
+			kv, tensors := writeAndDecode(t, arch)
+			if got := kv["general.file_type"]; got != tt.fileType {
+				t.Errorf("expected file type %d, got %v", tt.fileType, got)
+			}
+
+			for _, tensor := range tensors {
+				if want, ok := tt.kinds[tensor.Name]; !ok {
+					t.Errorf("unexpected tensor %s", tensor.Name)
+				} else if tensor.Kind != want {
+					t.Errorf("expected %s kind %d, got %d", tensor.Name, want, tensor.Kind)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteGGUFBigEndian(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":       []string{"LlamaForCausalLM"},
+		"hidden_size":         4,
+		"num_hidden_layers":   1,
+		"num_attention_heads": 1,
+	})
+
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+
+	norm := []float32{1, 2, 3, 4}
+	writeSafetensors(t, dir,
+		safetensor{name: "model.embed_tokens.weight", shape: []uint64{6, 4}},
+		safetensor{name: "model.norm.weight", shape: []uint64{4}, data: norm},
+		safetensor{name: "lm_head.weight", shape: []uint64{6, 4}},
+	)
+
+	mf, err := GetModelFormat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := mf.GetParams(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.OutputByteOrder = binary.BigEndian
+	params.Verify = true
+
+	arch, err := mf.GetModelArch("test", dir, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arch.GetTensors(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arch.LoadVocab(); err != nil {
+		t.Fatal(err)
+	}
+
+	kv, _ := writeAndDecode(t, arch)
+	if got := kv["llama.block_count"]; got != uint32(1) {
+		t.Errorf("expected block count 1, got %v", got)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "*.gguf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := arch.WriteGGUF(f); err != nil {
+		t.Fatal(err)
+	}
+
+	bts, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the magic is always GGUF, the version is written big-endian
+	if !bytes.Equal(bts[:8], []byte{'G', 'G', 'U', 'F', 0, 0, 0, 3}) {
+		t.Errorf("unexpected header % x", bts[:8])
+	}
+
+	var be, le bytes.Buffer
+	binary.Write(&be, binary.BigEndian, norm)
+	binary.Write(&le, binary.LittleEndian, norm)
+
+	if !bytes.Contains(bts, be.Bytes()) {
+		t.Error("expected big-endian tensor data")
+	}
+
+	if bytes.Contains(bts, le.Bytes()) {
+		t.Error("unexpected little-endian tensor data")
+	}
+}
+
+func TestWriteGGUFVersion(t *testing.T) {
+	write := func(t *testing.T, version int, order ByteOrder) ([]byte, error) {
+		t.Helper()
+
+		m := testGemmaModel(&Params{
+			HiddenSize:      2048,
+			HiddenLayers:    1,
+			AttentionHeads:  8,
+			GGUFVersion:     version,
+			OutputByteOrder: order,
+		})
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "model.gguf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := m.WriteGGUF(f); err != nil {
+			return nil, err
+		}
+
+		return os.ReadFile(f.Name())
+	}
+
+	for version, header := range map[int][]byte{
+		0: {'G', 'G', 'U', 'F', 3, 0, 0, 0},
+		2: {'G', 'G', 'U', 'F', 2, 0, 0, 0},
+		3: {'G', 'G', 'U', 'F', 3, 0, 0, 0},
+	} {
+		name := fmt.Sprintf("v%d", version)
+		if version == 0 {
+			name = "default"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			bts, err := write(t, version, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(bts[:8], header) {
+				t.Errorf("expected header % x, got % x", header, bts[:8])
+			}
+
+			m, _, err := llm.DecodeGGML(bytes.NewReader(bts), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := m.KV().Architecture(); got != "gemma" {
+				t.Errorf("expected architecture gemma, got %s", got)
+			}
+		})
+	}
+
+	for _, version := range []int{1, 4} {
+		t.Run(fmt.Sprintf("unsupported v%d", version), func(t *testing.T) {
+			if _, err := write(t, version, nil); err == nil {
+				t.Errorf("expected an error writing ggufv%d", version)
+			}
+		})
+	}
+
+	t.Run("v2 big-endian", func(t *testing.T) {
+		if _, err := write(t, 2, binary.BigEndian); err == nil {
+			t.Error("expected an error writing a big-endian ggufv2")
+		}
+	})
+}
+
+func TestSkipTensors(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":       []string{"LlamaForCausalLM"},
+		"hidden_size":         4,
+		"num_hidden_layers":   1,
+		"num_attention_heads": 1,
+	})
+
+	writeSentencePieceModel(t, dir, testSentencePieces...)
+
+	writeSafetensors(t, dir,
+		safetensor{name: "model.embed_tokens.weight", shape: []uint64{6, 4}},
+		safetensor{name: "model.layers.0.self_attn.rotary_emb.inv_freq", shape: []uint64{2}},
+		safetensor{name: "model.norm.weight", shape: []uint64{4}},
+		safetensor{name: "lm_head.weight", shape: []uint64{6, 4}},
+	)
+
+	newArch := func(t *testing.T, skip ...string) (ModelArch, error) {
+		mf, err := GetModelFormat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params, err := mf.GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.SkipTensors = skip
+		params.Verify = true
+
+		arch, err := mf.GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return arch, arch.GetTensors()
+	}
+
+	if _, err := newArch(t); err == nil {
+		t.Error("expected an error for an unknown tensor")
+	}
+
+	if _, err := newArch(t, "("); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+
+	// patterns are checked up front, not when a tensor is first matched
+	if _, err := (&Params{SkipTensors: []string{`lm_head`, "("}}).skipper(); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+
+	arch, err := newArch(t, `rotary_emb\.inv_freq$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arch.LoadVocab(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, tensors := writeAndDecode(t, arch)
+
+	var names []string
+	for _, t := range tensors {
+		names = append(names, t.Name)
+	}
+
+	if expect := []string{"token_embd.weight", "output_norm.weight", "output.weight"}; !slices.Equal(names, expect) {
+		t.Errorf("expected %v, got %v", expect, names)
+	}
+}
+
+func TestRenameTensors(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, dir, "config.json", map[string]any{
+		"architectures":       []string{"GemmaForCausalLM"},
+		"hidden_size":         4,
+		"num_hidden_layers":   1,
+		"num_attention_heads": 1,
+	})
+
+	writeSafetensors(t, dir,
+		safetensor{name: "model.embed.weight", shape: []uint64{6, 4}},
+		safetensor{name: "model.layers.0.attn_norm.weight", shape: []uint64{4}},
+		safetensor{name: "model.norm.weight", shape: []uint64{4}},
+	)
+
+	getTensors := func(t *testing.T, renames map[string]string) (*GemmaModel, error) {
+		params, err := (&SafetensorFormat{}).GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.RenameTensors = renames
+
+		arch, err := (&SafetensorFormat{}).GetModelArch("test", dir, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return arch.(*GemmaModel), arch.GetTensors()
+	}
+
+	if _, err := getTensors(t, nil); err == nil {
+		t.Error("expected an error for unknown tensors")
+	}
+
+	m, err := getTensors(t, map[string]string{
+		"model.embed.weight":              "model.embed_tokens.weight",
+		"model.layers.0.attn_norm.weight": "model.layers.0.input_layernorm.weight",
+		"model.missing.weight":            "model.unused.weight",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, t := range m.Tensors {
+		names = append(names, t.Name)
+	}
+	slices.Sort(names)
+
+	if expect := []string{"blk.0.attn_norm.weight", "output_norm.weight", "token_embd.weight"}; !slices.Equal(names, expect) {
+		t.Errorf("expected %v, got %v", expect, names)
+	}
+
+	// renamed norms still get gemma's repacking
+	i := slices.IndexFunc(m.Tensors, func(t llm.Tensor) bool { return t.Name == "blk.0.attn_norm.weight" })
+	if wt := m.Tensors[i].WriterTo.(safetensorWriterTo); wt.repacker == nil {
+		t.Error("expected blk.0.attn_norm.weight to be repacked")
+	}
+
+	_, err = getTensors(t, map[string]string{
+		"model.embed.weight":              "model.embed_tokens.weight",
+		"model.layers.0.attn_norm.weight": "model.norm.weight",
+	})
+	if err == nil || !strings.Contains(err.Error(), "model.norm.weight") {
+		t.Errorf("expected a collision error naming model.norm.weight, got %v", err)
+	}
+}
+
+func TestRemoteCode(t *testing.T) {
+	newDir := func(t *testing.T, arch string) string {
+		dir := t.TempDir()
+		writeJSON(t, dir, "config.json", map[string]any{
+			"architectures":       []string{arch},
+			"hidden_size":         4,
+			"num_attention_heads": 1,
+			"auto_map": map[string]any{
+				"AutoConfig":           "configuration_custom.CustomConfig",
+				"AutoModelForCausalLM": "modeling_custom.CustomForCausalLM",
+			},
+		})
+
+		writeSafetensors(t, dir, safetensor{name: "model.norm.weight", shape: []uint64{4}})
+		return dir
+	}
+
+	getModelArch := func(t *testing.T, dir string, trust bool) error {
+		mf, err := GetModelFormat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params, err := mf.GetParams(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.TrustRemoteCode = trust
+
+		_, err = mf.GetModelArch("test", dir, params)
+		return err
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		if err := getModelArch(t, newDir(t, "LlamaForCausalLM"), false); !errors.Is(err, ErrRemoteCode) {
+			t.Errorf("expected ErrRemoteCode, got %v", err)
+		}
+	})
+
+	t.Run("trusted", func(t *testing.T) {
+		if err := getModelArch(t, newDir(t, "LlamaForCausalLM"), true); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("implemented", func(t *testing.T) {
+		if err := getModelArch(t, newDir(t, "InternLM2ForCausalLM"), false); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestEditGGUF(t *testing.T) {
+	// tensor sizes that aren't a multiple of the alignment so the data is
+	// padded between them
+	tensors := []llm.Tensor{
+		{Name: "token_embd.weight", Kind: 0, Offset: 0, Shape: []uint64{3, 1}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{1}, 12))},
+		{Name: "output_norm.weight", Kind: 0, Offset: 32, Shape: []uint64{5}, WriterTo: bytes.NewReader(bytes.Repeat([]byte{2}, 20))},
+	}
+
+	dir := t.TempDir()
+	src, err := os.Create(filepath.Join(dir, "src.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	kv := llm.KV{
+		"general.architecture":      "llama",
+		"general.name":              "before",
+		"llama.block_count":         uint32(1),
+		"llama.rope.freq_base":      float32(10000),
+		"tokenizer.ggml.tokens":     []string{"a", "b", "c"},
+		"tokenizer.ggml.token_type": []int32{1, 1, 1},
+	}
+	if err := llm.NewGGUFV3(binary.LittleEndian).Encode(src, kv, tensors); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := os.Create(filepath.Join(dir, "dst.gguf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if err := EditGGUF(dst, src, size, map[string]any{"general.name": "after"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// decode returns the end of the tensor data, which the offset and size
+	// of the last tensor lead back to the start of
+	decode := func(f *os.File) (llm.KV, map[string][]byte) {
+		t.Helper()
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		m, end, err := llm.DecodeGGML(f, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ts := m.Tensors()
+		last := ts[len(ts)-1]
+		start := end - int64(last.Offset+last.Size())
+
+		data := make(map[string][]byte)
+		for _, tensor := range ts {
+			b := make([]byte, tensor.Size())
+			if _, err := f.ReadAt(b, start+int64(tensor.Offset)); err != nil {
+				t.Fatal(err)
+			}
+
+			data[tensor.Name] = b
+		}
+
+		return m.KV(), data
+	}
+
+	srcKV, srcData := decode(src)
+	dstKV, dstData := decode(dst)
+
+	if got := dstKV["general.name"]; got != "after" {
+		t.Errorf("expected general.name after, got %v", got)
+	}
+
+	delete(srcKV, "general.name")
+	delete(dstKV, "general.name")
+
+	want, err := json.Marshal(srcKV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := json.Marshal(dstKV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected the rest of the metadata unchanged\nwant %s\n got %s", want, got)
+	}
+
+	if !maps.EqualFunc(dstData, srcData, bytes.Equal) {
+		t.Errorf("expected tensors %v, got %v", srcData, dstData)
+	}
+
+	t.Run("invalid override", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "model.gguf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := EditGGUF(f, src, size, map[string]any{"llama.block_count": "many"}); err == nil {
+			t.Error("expected an error for a block count that isn't a number")
+		}
+	})
+}
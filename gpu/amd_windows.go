@@ -49,7 +49,7 @@ func AMDGetGPUInfo() []RocmGPUInfo {
 	}
 	libDir, err := AMDValidateLibDir()
 	if err != nil {
-		slog.Warn("unable to verify rocm library, will use cpu", "error", err)
+		warnDetection("unable to verify rocm library, will use cpu", "error", err)
 		return nil
 	}
 
@@ -58,7 +58,7 @@ func AMDGetGPUInfo() []RocmGPUInfo {
 	if gfxOverride == "" {
 		supported, err = GetSupportedGFX(libDir)
 		if err != nil {
-			slog.Warn("failed to lookup supported GFX types, falling back to CPU mode", "error", err)
+			warnDetection("failed to lookup supported GFX types, falling back to CPU mode", "error", err)
 			return nil
 		}
 	} else {
@@ -94,9 +94,9 @@ func AMDGetGPUInfo() []RocmGPUInfo {
 		}
 		if gfxOverride == "" {
 			if !slices.Contains[[]string, string](supported, gfx) {
-				slog.Warn("amdgpu is not supported", "gpu", i, "gpu_type", gfx, "library", libDir, "supported_types", supported)
+				warnDetection("amdgpu is not supported", "gpu", i, "gpu_type", gfx, "library", libDir, "supported_types", supported)
 				// TODO - consider discrete markdown just for ROCM troubleshooting?
-				slog.Warn("See https://github.com/ollama/ollama/blob/main/docs/troubleshooting.md for HSA_OVERRIDE_GFX_VERSION usage")
+				warnDetection("See https://github.com/ollama/ollama/blob/main/docs/troubleshooting.md for HSA_OVERRIDE_GFX_VERSION usage")
 				continue
 			} else {
 				slog.Debug("amdgpu is supported", "gpu", i, "gpu_type", gfx)
@@ -162,7 +162,7 @@ func AMDValidateLibDir() (string, error) {
 	}
 
 	// Should not happen on windows since we include it in the installer, but stand-alone binary might hit this
-	slog.Warn("amdgpu detected, but no compatible rocm library found.  Please install ROCm")
+	warnDetection("amdgpu detected, but no compatible rocm library found.  Please install ROCm")
 	return "", fmt.Errorf("no suitable rocm found, falling back to CPU")
 }
 
@@ -35,17 +35,13 @@ func PayloadsDir() (string, error) {
 
 		// The remainder only applies on non-windows where we still carry payloads in the main executable
 		cleanupTmpDirs()
-		tmpDir := envconfig.TmpDir
-		if tmpDir == "" {
-			tmpDir, err = os.MkdirTemp("", "ollama")
+		tmpDir := envconfig.TempDir()
+		if tmpDir != envconfig.TmpDir {
+			// OLLAMA_TMPDIR is unset or unusable so use a private directory
+			tmpDir, err = os.MkdirTemp(tmpDir, "ollama")
 			if err != nil {
 				return "", fmt.Errorf("failed to generate tmp dir: %w", err)
 			}
-		} else {
-			err = os.MkdirAll(tmpDir, 0755)
-			if err != nil {
-				return "", fmt.Errorf("failed to generate tmp dir %s: %w", tmpDir, err)
-			}
 		}
 
 		// Track our pid so we can clean up orphaned tmpdirs
@@ -228,6 +228,12 @@ func GetGPUInfo() GpuInfoList {
 			return GpuInfoList{cpus[0].GpuInfo}
 		}
 
+		if envconfig.DisableGPU {
+			slog.Info("GPU discovery disabled by OLLAMA_DISABLE_GPU")
+			bootstrapped = true
+			return GpuInfoList{cpus[0].GpuInfo}
+		}
+
 		// On windows we bundle the nvidia library one level above the runner dir
 		depPath := ""
 		if runtime.GOOS == "windows" && envconfig.RunnersDir != "" {
@@ -414,7 +420,7 @@ func GetGPUInfo() GpuInfoList {
 		}
 	}
 
-	resp := []GpuInfo{}
+	resp := GpuInfoList{}
 	for _, gpu := range cudaGPUs {
 		resp = append(resp, gpu.GpuInfo)
 	}
@@ -427,6 +433,7 @@ func GetGPUInfo() GpuInfoList {
 	if len(resp) == 0 {
 		resp = append(resp, cpus[0].GpuInfo)
 	}
+	resp.capFreeMemory()
 	return resp
 }
 
@@ -521,12 +528,12 @@ func LoadNVCUDAMgmt(nvcudaLibPaths []string) (int, *C.nvcuda_handle_t, string) {
 			msg := C.GoString(resp.err)
 			switch resp.cudaErr {
 			case C.CUDA_ERROR_INSUFFICIENT_DRIVER, C.CUDA_ERROR_SYSTEM_DRIVER_MISMATCH:
-				slog.Warn("version mismatch between driver and cuda driver library - reboot or upgrade may be required", "library", libPath, "error", msg)
+				warnDetection("version mismatch between driver and cuda driver library - reboot or upgrade may be required", "library", libPath, "error", msg)
 			case C.CUDA_ERROR_NO_DEVICE:
 				slog.Info("no nvidia devices detected", "library", libPath)
 			case C.CUDA_ERROR_UNKNOWN:
-				slog.Warn("unknown error initializing cuda driver library", "library", libPath, "error", msg)
-				slog.Warn("see https://github.com/ollama/ollama/blob/main/docs/troubleshooting.md for more information")
+				warnDetection("unknown error initializing cuda driver library", "library", libPath, "error", msg)
+				warnDetection("see https://github.com/ollama/ollama/blob/main/docs/troubleshooting.md for more information")
 			default:
 				if strings.Contains(msg, "wrong ELF class") {
 					slog.Debug("skipping 32bit library", "library", libPath)
@@ -11,6 +11,7 @@ import "C"
 import (
 	"runtime"
 
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 )
 
@@ -20,7 +21,7 @@ const (
 
 func GetGPUInfo() GpuInfoList {
 	mem, _ := GetCPUMem()
-	if runtime.GOARCH == "amd64" {
+	if runtime.GOARCH == "amd64" || envconfig.DisableGPU {
 		return []GpuInfo{
 			{
 				Library: "cpu",
@@ -39,7 +40,9 @@ func GetGPUInfo() GpuInfoList {
 	info.FreeMemory = info.TotalMemory
 
 	info.MinimumMemory = metalMinimumMemory
-	return []GpuInfo{info}
+	resp := GpuInfoList{info}
+	resp.capFreeMemory()
+	return resp
 }
 
 func GetCPUInfo() GpuInfoList {
@@ -6,6 +6,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ollama/ollama/envconfig"
 )
 
 func TestBasicGetGPUInfo(t *testing.T) {
@@ -33,3 +35,21 @@ func TestCPUMemInfo(t *testing.T) {
 }
 
 // TODO - add some logic to figure out card type through other means and actually verify we got back what we expected
+
+func TestCapFreeMemory(t *testing.T) {
+	t.Cleanup(envconfig.LoadConfig)
+	t.Setenv("OLLAMA_MAX_VRAM", "")
+	t.Setenv("OLLAMA_MAX_VRAM_PER_GPU", "4GiB,,16GiB")
+	envconfig.LoadConfig()
+
+	gpus := GpuInfoList{
+		{Library: "cuda", ID: "0", memInfo: memInfo{FreeMemory: 8 << 30}},
+		{Library: "cuda", ID: "1", memInfo: memInfo{FreeMemory: 8 << 30}},
+		{Library: "cuda", ID: "2", memInfo: memInfo{FreeMemory: 8 << 30}},
+	}
+
+	gpus.capFreeMemory()
+	assert.Equal(t, uint64(4<<30), gpus[0].FreeMemory)
+	assert.Equal(t, uint64(8<<30), gpus[1].FreeMemory)
+	assert.Equal(t, uint64(8<<30), gpus[2].FreeMemory)
+}
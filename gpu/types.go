@@ -1,12 +1,25 @@
 package gpu
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 )
 
+// warnDetection logs a non-fatal GPU detection warning, which is logged at
+// debug level instead when OLLAMA_SUPPRESS_GPU_WARNINGS is set.
+func warnDetection(msg string, args ...any) {
+	level := slog.LevelWarn
+	if envconfig.NoGPUWarnings {
+		level = slog.LevelDebug
+	}
+
+	slog.Log(context.TODO(), level, msg, args...)
+}
+
 type memInfo struct {
 	TotalMemory uint64 `json:"total_memory,omitempty"`
 	FreeMemory  uint64 `json:"free_memory,omitempty"`
@@ -97,6 +110,21 @@ func (l GpuInfoList) ByLibrary() []GpuInfoList {
 	return resp
 }
 
+// capFreeMemory limits the free memory of each GPU to OLLAMA_MAX_VRAM_PER_GPU
+// for its ordinal, its position in the list, or to OLLAMA_MAX_VRAM.
+func (l GpuInfoList) capFreeMemory() {
+	for i := range l {
+		if l[i].Library == "cpu" {
+			continue
+		}
+
+		if limit := envconfig.MaxVRAMForGPU(i); limit > 0 && l[i].FreeMemory > limit {
+			slog.Debug("limiting gpu memory", "id", l[i].ID, "library", l[i].Library, "available", format.HumanBytes2(l[i].FreeMemory), "limit", format.HumanBytes2(limit))
+			l[i].FreeMemory = limit
+		}
+	}
+}
+
 // Report the GPU information into the log an Info level
 func (l GpuInfoList) LogDetails() {
 	for _, g := range l {
@@ -225,6 +225,8 @@ func (t Tensor) typeSize() uint64 {
 		return 8
 	case 29: // IQ1_M
 		return blockSize/8 + blockSize/16 + blockSize/32
+	case 30: // BF16
+		return 2
 	default:
 		return 0
 	}
@@ -280,6 +282,27 @@ func DetectGGMLType(b []byte) string {
 	}
 }
 
+// ggufByteOrder peeks at the version following the GGUF magic to detect the
+// file's byte order. The magic reads the same either way but versions are
+// small, so like llama.cpp, a version with its low 16 bits unset is taken to
+// be byte swapped.
+func ggufByteOrder(rs io.ReadSeeker) (binary.ByteOrder, error) {
+	var version uint32
+	if err := binary.Read(rs, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+
+	if _, err := rs.Seek(-4, io.SeekCurrent); err != nil {
+		return nil, err
+	}
+
+	if version&0xffff == 0 {
+		return binary.BigEndian, nil
+	}
+
+	return binary.LittleEndian, nil
+}
+
 // DecodeGGML decodes a GGML model from the given reader.
 //
 // It collects array values for arrays with a size less than or equal to
@@ -304,7 +327,12 @@ func DecodeGGML(rs io.ReadSeeker, maxArraySize int) (*GGML, int64, error) {
 	case FILE_MAGIC_GGLA:
 		c = &containerGGLA{}
 	case FILE_MAGIC_GGUF_LE:
-		c = &containerGGUF{ByteOrder: binary.LittleEndian, maxArraySize: maxArraySize}
+		bo, err := ggufByteOrder(rs)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		c = &containerGGUF{ByteOrder: bo, maxArraySize: maxArraySize}
 	case FILE_MAGIC_GGUF_BE:
 		c = &containerGGUF{ByteOrder: binary.BigEndian, maxArraySize: maxArraySize}
 	default:
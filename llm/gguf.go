@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 )
 
@@ -90,6 +91,10 @@ type gguf struct {
 
 	parameters uint64
 
+	// dataOffset is where the tensor data starts in the decoded file.
+	// Tensor offsets are relative to it
+	dataOffset int64
+
 	scratch [16 << 10]byte
 }
 
@@ -101,7 +106,14 @@ func newGGUF(container *containerGGUF) *gguf {
 }
 
 func NewGGUFV3(bo binary.ByteOrder) *gguf {
-	return newGGUF(&containerGGUF{ByteOrder: bo, Version: 3})
+	return NewGGUF(bo, 3)
+}
+
+// NewGGUF returns a GGUF of the given format version for encoding. Older
+// runners only read version 2, which has the same layout as version 3 but
+// is always little-endian. Encode reports an error for any other version.
+func NewGGUF(bo binary.ByteOrder, version uint32) *gguf {
+	return newGGUF(&containerGGUF{ByteOrder: bo, Version: version})
 }
 
 func (llm *gguf) KV() KV {
@@ -236,6 +248,13 @@ func (llm *gguf) Decode(rs io.ReadSeeker) error {
 		alignment = 32
 	}
 
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to get current offset: %w", err)
+	}
+
+	llm.dataOffset = offset + llm.padding(offset, int64(alignment))
+
 	for _, tensor := range llm.tensors {
 		offset, err := rs.Seek(0, io.SeekCurrent)
 		if err != nil {
@@ -344,6 +363,9 @@ func writeGGUFString(llm *gguf, w io.Writer, s string) error {
 }
 
 type array struct {
+	// t is the gguf type of the elements, so the array can be encoded
+	// again as read
+	t      uint32
 	size   int
 	values []any
 }
@@ -363,7 +385,7 @@ func readGGUFV1Array(llm *gguf, r io.Reader) (*array, error) {
 		return nil, err
 	}
 
-	a := &array{size: int(n)}
+	a := &array{t: t, size: int(n)}
 	if llm.canCollectArray(int(n)) {
 		a.values = make([]any, 0, int(n))
 	}
@@ -425,7 +447,7 @@ func readGGUFArray(llm *gguf, r io.Reader) (*array, error) {
 		return nil, err
 	}
 
-	a := &array{size: int(n)}
+	a := &array{t: t, size: int(n)}
 	if llm.canCollectArray(int(n)) {
 		a.values = make([]any, int(n))
 	}
@@ -498,6 +520,40 @@ func writeGGUFArray[S ~[]E, E any](llm *gguf, w io.Writer, t uint32, s S) error
 	return nil
 }
 
+func writeGGUFDecodedArray(llm *gguf, w io.Writer, a *array) error {
+	if err := binary.Write(w, llm.ByteOrder, ggufTypeArray); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, llm.ByteOrder, a.t); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, llm.ByteOrder, uint64(len(a.values))); err != nil {
+		return err
+	}
+
+	for _, e := range a.values {
+		if s, ok := e.(string); ok {
+			if err := binary.Write(w, llm.ByteOrder, uint64(len(s))); err != nil {
+				return err
+			}
+
+			if _, err := io.WriteString(w, s); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := binary.Write(w, llm.ByteOrder, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 var ggufKVOrder = map[string][]string{
 	"llama": {
 		"general.architecture",
@@ -542,6 +598,13 @@ var ggufKVOrder = map[string][]string{
 
 func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 	switch llm.Version {
+	case 2:
+		if llm.ByteOrder != binary.LittleEndian {
+			return fmt.Errorf("ggufv2 is little-endian only, %s needs ggufv3", llm.ByteOrder)
+		}
+
+		llm.V2.NumTensor = uint64(len(tensors))
+		llm.V2.NumKV = uint64(len(kv))
 	case 3:
 		llm.V3.NumTensor = uint64(len(tensors))
 		llm.V3.NumKV = uint64(len(kv))
@@ -565,17 +628,27 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 		return err
 	}
 
-	kvCheck := make(map[string]bool)
-	for k := range kv {
-		kvCheck[k] = false
+	// write known keys in their canonical order followed by any remaining
+	// keys sorted by name
+	var keys []string
+	for _, k := range ggufKVOrder["llama"] {
+		if _, ok := kv[k]; ok {
+			keys = append(keys, k)
+		}
 	}
 
-	for _, k := range ggufKVOrder["llama"] {
-		v, ok := kv[k]
-		if !ok {
-			continue
+	var extra []string
+	for k := range kv {
+		if !slices.Contains(keys, k) {
+			extra = append(extra, k)
 		}
-		kvCheck[k] = true
+	}
+
+	slices.Sort(extra)
+	keys = append(keys, extra...)
+
+	for _, k := range keys {
+		v := kv[k]
 
 		if err := binary.Write(ws, llm.ByteOrder, uint64(len(k))); err != nil {
 			return err
@@ -587,8 +660,24 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 
 		var err error
 		switch v := v.(type) {
+		case uint8:
+			err = writeGGUF(llm, ws, ggufTypeUint8, v)
+		case int8:
+			err = writeGGUF(llm, ws, ggufTypeInt8, v)
+		case uint16:
+			err = writeGGUF(llm, ws, ggufTypeUint16, v)
+		case int16:
+			err = writeGGUF(llm, ws, ggufTypeInt16, v)
 		case uint32:
 			err = writeGGUF(llm, ws, ggufTypeUint32, v)
+		case int32:
+			err = writeGGUF(llm, ws, ggufTypeInt32, v)
+		case uint64:
+			err = writeGGUF(llm, ws, ggufTypeUint64, v)
+		case int64:
+			err = writeGGUF(llm, ws, ggufTypeInt64, v)
+		case float64:
+			err = writeGGUF(llm, ws, ggufTypeFloat64, v)
 		case float32:
 			err = writeGGUF(llm, ws, ggufTypeFloat32, v)
 		case bool:
@@ -601,6 +690,8 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 			err = writeGGUFArray(llm, ws, ggufTypeUint32, v)
 		case []float32:
 			err = writeGGUFArray(llm, ws, ggufTypeFloat32, v)
+		case []bool:
+			err = writeGGUFArray(llm, ws, ggufTypeBool, v)
 		case []string:
 			if err := binary.Write(ws, llm.ByteOrder, ggufTypeArray); err != nil {
 				return err
@@ -623,6 +714,14 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 					return err
 				}
 			}
+		case *array:
+			// arrays decoded from another file are written back with
+			// their own element type
+			if v.values == nil && v.size > 0 {
+				return fmt.Errorf("array '%s' of %d elements wasn't decoded", k, v.size)
+			}
+
+			err = writeGGUFDecodedArray(llm, ws, v)
 		default:
 			return fmt.Errorf("improper type for '%s'", k)
 		}
@@ -631,12 +730,6 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 		}
 	}
 
-	for k, v := range kvCheck {
-		if !v {
-			return fmt.Errorf("Didn't know how to write kv %s", k)
-		}
-	}
-
 	for _, tensor := range tensors {
 		if err := binary.Write(ws, llm.ByteOrder, uint64(len(tensor.Name))); err != nil {
 			return err
@@ -673,6 +766,10 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 	}
 
 	var alignment int64 = 32
+	if a, ok := kv["general.alignment"].(uint32); ok {
+		alignment = int64(a)
+	}
+
 	for _, tensor := range tensors {
 		offset, err := ws.Seek(0, io.SeekCurrent)
 		if err != nil {
@@ -692,6 +789,76 @@ func (llm *gguf) Encode(ws io.WriteSeeker, kv KV, tensors []Tensor) error {
 	return nil
 }
 
+// RewriteGGUF writes the GGUF in r to ws with its key-values changed by
+// edit. Tensors are copied verbatim, in the same byte order, so nothing is
+// reconverted or requantized.
+func RewriteGGUF(ws io.WriteSeeker, r io.ReaderAt, size int64, edit func(KV) error) error {
+	ggml, _, err := DecodeGGML(io.NewSectionReader(r, 0, size), -1)
+	if err != nil {
+		return err
+	}
+
+	src, ok := ggml.model.(*gguf)
+	if !ok {
+		return fmt.Errorf("not a gguf: %s", ggml.Name())
+	}
+
+	kv := src.KV()
+
+	// the parameter count is computed when decoding, it isn't stored
+	delete(kv, "general.parameter_count")
+
+	if err := edit(kv); err != nil {
+		return err
+	}
+
+	alignment, ok := kv["general.alignment"].(uint32)
+	if !ok {
+		alignment = 32
+	}
+
+	tensors := make([]Tensor, len(src.tensors))
+	var offset uint64
+	for i, t := range src.tensors {
+		// decoded shapes are padded to four dimensions in gguf order, while
+		// Encode takes them outermost first
+		dims := len(t.Shape)
+		for dims > 1 && t.Shape[dims-1] == 1 {
+			dims--
+		}
+
+		shape := slices.Clone(t.Shape[:dims])
+		slices.Reverse(shape)
+
+		offset += uint64(src.padding(int64(offset), int64(alignment)))
+		tensors[i] = Tensor{
+			Name:     t.Name,
+			Kind:     t.Kind,
+			Offset:   offset,
+			Shape:    shape,
+			WriterTo: sectionWriterTo{io.NewSectionReader(r, src.dataOffset+int64(t.Offset), int64(t.Size()))},
+		}
+
+		offset += t.Size()
+	}
+
+	// version 1 can't be encoded, it's written as the current version
+	version := src.Version
+	if version == 1 {
+		version = 3
+	}
+
+	return NewGGUF(src.ByteOrder, version).Encode(ws, kv, tensors)
+}
+
+type sectionWriterTo struct {
+	*io.SectionReader
+}
+
+func (s sectionWriterTo) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, s.SectionReader)
+}
+
 func (gguf) padding(offset, align int64) int64 {
 	return (align - offset%align) % align
 }
@@ -82,6 +82,17 @@ func LoadModel(model string, maxArraySize int) (*GGML, error) {
 
 // NewLlamaServer will run a server for the given GPUs
 // The gpu list must be a single family.
+// numaParams returns the runner flags for NUMA optimizations, which are
+// enabled per request or for every model with OLLAMA_NUMA. The runner
+// requires a strategy after --numa.
+func numaParams(opts api.Options) []string {
+	if opts.UseNUMA || envconfig.NUMA {
+		return []string{"--numa", "distribute"}
+	}
+
+	return nil
+}
+
 func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, projectors []string, opts api.Options, numParallel int) (LlamaServer, error) {
 	var err error
 	var cpuRunner string
@@ -201,15 +212,21 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		params = append(params, "--mmproj", projectors[0])
 	}
 
-	if opts.NumThread > 0 {
-		params = append(params, "--threads", fmt.Sprintf("%d", opts.NumThread))
+	// request options take precedence over the server wide settings
+	numThread := opts.NumThread
+	if numThread == 0 {
+		numThread = envconfig.NumThreads
+	}
+
+	if numThread > 0 {
+		params = append(params, "--threads", fmt.Sprintf("%d", numThread))
 	}
 
 	if !opts.F16KV {
 		params = append(params, "--memory-f32")
 	}
 
-	flashAttnEnabled := envconfig.FlashAttention
+	flashAttnEnabled := envconfig.FlashAttentionFor(ggml.KV().Architecture())
 
 	for _, g := range gpus {
 		// only cuda (compute capability 7+) and metal support flash attention
@@ -230,6 +247,19 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		params = append(params, "--flash-attn")
 	}
 
+	if envconfig.CacheTypeK != "f16" {
+		params = append(params, "--cache-type-k", envconfig.CacheTypeK)
+	}
+
+	if envconfig.CacheTypeV != "f16" {
+		// llama.cpp can only quantize the V cache with flash attention
+		if flashAttnEnabled {
+			params = append(params, "--cache-type-v", envconfig.CacheTypeV)
+		} else {
+			slog.Warn("quantized V cache requires flash attention, using f16", "type", envconfig.CacheTypeV)
+		}
+	}
+
 	// Windows CUDA should not use mmap for best performance
 	// Linux  with a model larger than free space, mmap leads to thrashing
 	// For CPU loads we want the memory to be allocated, not FS cache
@@ -244,9 +274,7 @@ func NewLlamaServer(gpus gpu.GpuInfoList, model string, ggml *GGML, adapters, pr
 		params = append(params, "--mlock")
 	}
 
-	if opts.UseNUMA {
-		params = append(params, "--numa")
-	}
+	params = append(params, numaParams(opts)...)
 
 	params = append(params, "--parallel", fmt.Sprintf("%d", numParallel))
 
@@ -556,8 +584,8 @@ func (s *llmServer) Ping(ctx context.Context) error {
 
 func (s *llmServer) WaitUntilRunning(ctx context.Context) error {
 	start := time.Now()
-	stallDuration := 5 * time.Minute            // If no progress happens
-	finalLoadDuration := 5 * time.Minute        // After we hit 100%, give the runner more time to come online
+	stallDuration := envconfig.LoadTimeout      // If no progress happens
+	finalLoadDuration := envconfig.LoadTimeout  // After we hit 100%, give the runner more time to come online
 	stallTimer := time.Now().Add(stallDuration) // give up if we stall
 
 	slog.Info("waiting for llama runner to start responding")
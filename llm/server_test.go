@@ -0,0 +1,34 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+func TestNUMAParams(t *testing.T) {
+	t.Cleanup(envconfig.LoadConfig)
+
+	cases := []struct {
+		env     string
+		useNUMA bool
+		expect  []string
+	}{
+		{"", false, nil},
+		{"", true, []string{"--numa", "distribute"}},
+		{"1", false, []string{"--numa", "distribute"}},
+		{"1", true, []string{"--numa", "distribute"}},
+	}
+
+	for _, tt := range cases {
+		t.Setenv("OLLAMA_NUMA", tt.env)
+		envconfig.LoadConfig()
+
+		opts := api.DefaultOptions()
+		opts.UseNUMA = tt.useNUMA
+		require.Equal(t, tt.expect, numaParams(opts), "OLLAMA_NUMA=%q numa=%v", tt.env, tt.useNUMA)
+	}
+}
@@ -20,12 +20,20 @@ type History struct {
 	Enabled  bool
 }
 
-func NewHistory() (*History, error) {
+// NewHistory returns a History backed by filename. An empty filename
+// disables history, and nothing is read from or written to disk even if it's
+// enabled again later, such as with /set history.
+func NewHistory(filename string) (*History, error) {
 	h := &History{
 		Buf:      arraylist.New(),
 		Limit:    100, // resizeme
 		Autosave: true,
-		Enabled:  true,
+		Enabled:  filename != "",
+		Filename: filename,
+	}
+
+	if filename == "" {
+		return h, nil
 	}
 
 	err := h.Init()
@@ -37,18 +45,11 @@ func NewHistory() (*History, error) {
 }
 
 func (h *History) Init() error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-
-	path := filepath.Join(home, ".ollama", "history")
+	path := h.Filename
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
 
-	h.Filename = path
-
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -126,7 +127,7 @@ func (h *History) Size() int {
 }
 
 func (h *History) Save() error {
-	if !h.Enabled {
+	if !h.Enabled || h.Filename == "" {
 		return nil
 	}
 
@@ -42,13 +42,15 @@ type Instance struct {
 	Pasting  bool
 }
 
-func New(prompt Prompt) (*Instance, error) {
+// New returns an Instance reading from the terminal. History is kept in
+// historyFile; pass an empty string to disable it.
+func New(prompt Prompt, historyFile string) (*Instance, error) {
 	term, err := NewTerminal()
 	if err != nil {
 		return nil, err
 	}
 
-	history, err := NewHistory()
+	history, err := NewHistory(historyFile)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+)
+
+var ErrInsufficientDiskSpace = errors.New("not enough disk space")
+
+// diskFree returns the bytes available to unprivileged users on the
+// filesystem holding path. It's a variable so tests can replace it.
+var diskFree = freeDiskSpace
+
+// CheckDiskSpace returns ErrInsufficientDiskSpace if writing needed more
+// bytes to the models directory would leave less than OLLAMA_MIN_FREE_DISK
+// free.
+func CheckDiskSpace(needed uint64) error {
+	// the blobs directory is created if it doesn't exist yet
+	p, err := GetBlobsPath("")
+	if err != nil {
+		return err
+	}
+
+	free, err := diskFree(p)
+	if err != nil {
+		return err
+	}
+
+	minFree := envconfig.MinFreeDisk
+	if free < needed || free-needed < minFree {
+		if minFree > 0 {
+			return fmt.Errorf("%w: need %s plus %s kept free by OLLAMA_MIN_FREE_DISK, but only %s is available in %s",
+				ErrInsufficientDiskSpace, format.HumanBytes2(needed), format.HumanBytes2(minFree), format.HumanBytes2(free), envconfig.ModelsDir)
+		}
+
+		return fmt.Errorf("%w: need %s but only %s is available in %s",
+			ErrInsufficientDiskSpace, format.HumanBytes2(needed), format.HumanBytes2(free), envconfig.ModelsDir)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/format"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_MIN_FREE_DISK", "1GB")
+	envconfig.LoadConfig()
+	t.Cleanup(envconfig.LoadConfig)
+
+	diskFree = func(string) (uint64, error) { return 5 * format.GigaByte, nil }
+	t.Cleanup(func() { diskFree = freeDiskSpace })
+
+	cases := []struct {
+		needed uint64
+		err    error
+	}{
+		{0, nil},
+		{4 * format.GigaByte, nil},
+		{4*format.GigaByte + 1, ErrInsufficientDiskSpace},
+		{6 * format.GigaByte, ErrInsufficientDiskSpace},
+	}
+
+	for _, tt := range cases {
+		if err := CheckDiskSpace(tt.needed); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", format.HumanBytes2(tt.needed), tt.err, err)
+		}
+	}
+
+	t.Run("statfs error", func(t *testing.T) {
+		errStatfs := errors.New("statfs failed")
+		diskFree = func(string) (uint64, error) { return 0, errStatfs }
+
+		if err := CheckDiskSpace(1); !errors.Is(err, errStatfs) {
+			t.Errorf("expected %v, got %v", errStatfs, err)
+		}
+	})
+}
+
+func TestFreeDiskSpace(t *testing.T) {
+	free, err := freeDiskSpace(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if free == 0 {
+		t.Error("expected some free space")
+	}
+}
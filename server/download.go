@@ -22,11 +22,26 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/format"
 )
 
 const maxRetries = 6
 
+// maxDownloadBackoff caps the exponential delay between download attempts
+const maxDownloadBackoff = time.Minute
+
+// downloadBackoff returns how long to wait before retrying a failed download
+// for the given attempt, doubling OLLAMA_DOWNLOAD_BACKOFF each time.
+func downloadBackoff(try int) time.Duration {
+	sleep := envconfig.DownloadBackoff * time.Duration(math.Pow(2, float64(try)))
+	if sleep <= 0 || sleep > maxDownloadBackoff {
+		return maxDownloadBackoff
+	}
+
+	return sleep
+}
+
 var errMaxRetriesExceeded = errors.New("max retries exceeded")
 var errPartStalled = errors.New("part stalled")
 
@@ -163,7 +178,7 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 
 		g.Go(func() error {
 			var err error
-			for try := 0; try < maxRetries; try++ {
+			for try := 0; try <= envconfig.DownloadRetries; try++ {
 				w := io.NewOffsetWriter(file, part.StartsAt())
 				err = b.downloadChunk(inner, requestURL, w, part, opts)
 				switch {
@@ -174,7 +189,7 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *regis
 					try--
 					continue
 				case err != nil:
-					sleep := time.Second * time.Duration(math.Pow(2, float64(try)))
+					sleep := downloadBackoff(try)
 					slog.Info(fmt.Sprintf("%s part %d attempt %d failed: %v, retrying in %s", b.Digest[7:19], part.N, try, err, sleep))
 					time.Sleep(sleep)
 					continue
@@ -21,6 +21,9 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/auth"
@@ -186,15 +189,21 @@ type RootFS struct {
 }
 
 func GetManifest(mp ModelPath) (*Manifest, string, error) {
-	fp, err := mp.GetManifestPath()
+	fp, err := mp.findManifestPath()
 	if err != nil {
 		return nil, "", err
 	}
 
-	if _, err = os.Stat(fp); err != nil {
+	fi, err := os.Stat(fp)
+	if err != nil {
 		return nil, "", err
 	}
 
+	key := mp.String()
+	if manifest, digest, ok := cachedManifests.get(key, fp, fi); ok {
+		return manifest, digest, nil
+	}
+
 	var manifest *Manifest
 
 	bts, err := os.ReadFile(fp)
@@ -209,9 +218,108 @@ func GetManifest(mp ModelPath) (*Manifest, string, error) {
 		return nil, "", err
 	}
 
+	cachedManifests.put(key, fp, fi, manifest, shaStr)
 	return manifest, shaStr, nil
 }
 
+// ModelSize returns the number of bytes a model occupies on disk, including
+// its manifest. Blobs referenced by more than one layer are counted once.
+func ModelSize(mp ModelPath) (int64, error) {
+	fp, err := mp.findManifestPath()
+	if err != nil {
+		return 0, err
+	}
+
+	fi, err := os.Stat(fp)
+	if err != nil {
+		return 0, err
+	}
+
+	manifest, _, err := GetManifest(mp)
+	if err != nil {
+		return 0, err
+	}
+
+	size := fi.Size()
+	seen := make(map[string]struct{})
+	for _, layer := range append(manifest.Layers, manifest.Config) {
+		if layer == nil {
+			continue
+		}
+
+		if _, ok := seen[layer.Digest]; ok {
+			continue
+		}
+
+		seen[layer.Digest] = struct{}{}
+
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return 0, err
+		}
+
+		fi, err := os.Stat(p)
+		if err != nil {
+			return 0, fmt.Errorf("%s: blob %s: %w", mp.GetShortTagname(), layer.Digest, err)
+		}
+
+		size += fi.Size()
+	}
+
+	return size, nil
+}
+
+// ModelLayerDigest returns the digest of a local model's weights, the layer
+// of its manifest with the model media type. It's an error for the manifest
+// to have no such layer or several with different digests.
+func ModelLayerDigest(mp ModelPath) (string, error) {
+	manifest, _, err := GetManifest(mp)
+	if err != nil {
+		return "", err
+	}
+
+	var digest string
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != "application/vnd.ollama.image.model" {
+			continue
+		}
+
+		if digest != "" && digest != layer.Digest {
+			return "", fmt.Errorf("%s: ambiguous model weights in manifest, %s and %s", mp.GetShortTagname(), digest, layer.Digest)
+		}
+
+		digest = layer.Digest
+	}
+
+	if digest == "" {
+		return "", fmt.Errorf("%s: no model weights in manifest", mp.GetShortTagname())
+	}
+
+	return digest, nil
+}
+
+// ReadModelInfo reads the metadata of a local model's weights, such as its
+// architecture, context length, parameter count and file type, without
+// loading the model. Only the GGUF header and metadata are parsed.
+func ReadModelInfo(mp ModelPath) (llm.KV, error) {
+	digest, err := ModelLayerDigest(mp)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	ggml, err := llm.LoadModel(p, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: blob %s: %w", mp.GetShortTagname(), digest, err)
+	}
+
+	return ggml.KV(), nil
+}
+
 func GetModel(name string) (*Model, error) {
 	mp := ParseModelPath(name)
 	manifest, digest, err := GetManifest(mp)
@@ -311,20 +419,13 @@ func GetModel(name string) (*Model, error) {
 }
 
 func realpath(rel, from string) string {
-	abspath, err := filepath.Abs(from)
-	if err != nil {
-		return from
+	if expanded := expandHome(from); expanded != from {
+		return expanded
 	}
 
-	home, err := os.UserHomeDir()
+	abspath, err := filepath.Abs(from)
 	if err != nil {
-		return abspath
-	}
-
-	if from == "~" {
-		return home
-	} else if strings.HasPrefix(from, "~/") {
-		return filepath.Join(home, from[2:])
+		return from
 	}
 
 	if _, err := os.Stat(filepath.Join(rel, from)); err == nil {
@@ -392,15 +493,29 @@ func CreateModel(ctx context.Context, name model.Name, modelFileDir, quantizatio
 				if err != nil {
 					return err
 				}
-			} else if file, err := os.Open(realpath(modelFileDir, c.Args)); err == nil {
+			} else {
+				fp := realpath(modelFileDir, c.Args)
+
+				// check before anything else so files outside the sandbox
+				// are never touched, not even to see if they exist
+				if err := checkSandbox(fp); err != nil {
+					return err
+				}
+
+				if _, err := os.Stat(fp); err != nil {
+					return fmt.Errorf("invalid model reference: %s", c.Args)
+				}
+
+				file, err := os.Open(fp)
+				if err != nil {
+					return err
+				}
 				defer file.Close()
 
 				baseLayers, err = parseFromFile(ctx, file, "", fn)
 				if err != nil {
 					return err
 				}
-			} else {
-				return fmt.Errorf("invalid model reference: %s", c.Args)
 			}
 
 			for _, baseLayer := range baseLayers {
@@ -656,6 +771,8 @@ func CopyModel(src, dst model.Name) error {
 	}
 	defer dstfile.Close()
 
+	defer cachedManifests.invalidate(dstpath)
+
 	_, err = io.Copy(dstfile, srcfile)
 	return err
 }
@@ -760,6 +877,101 @@ func PruneLayers() error {
 	return nil
 }
 
+// BlobReferenceCounts returns the number of manifests referring to each blob
+// in the blobs directory, keyed by its sha256:<hex> digest. Blobs which no
+// manifest refers to are included with a count of 0; digests of missing blobs
+// are still counted.
+func BlobReferenceCounts() (map[string]int, error) {
+	manifests, err := Manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, m := range manifests {
+		seen := make(map[string]struct{})
+		for _, layer := range append(m.Layers, m.Config) {
+			if layer == nil {
+				continue
+			}
+
+			// a manifest listing a blob twice still only refers to it once
+			if _, ok := seen[layer.Digest]; !ok {
+				seen[layer.Digest] = struct{}{}
+				counts[layer.Digest]++
+			}
+		}
+	}
+
+	p, err := GetBlobsPath("")
+	if err != nil {
+		return nil, err
+	}
+
+	blobs, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, blob := range blobs {
+		digest := strings.Replace(blob.Name(), "-", ":", 1)
+		if _, err := ResolveBlobPath(digest); err != nil {
+			continue
+		}
+
+		if _, ok := counts[digest]; !ok {
+			counts[digest] = 0
+		}
+	}
+
+	return counts, nil
+}
+
+var ErrPruneDisabled = errors.New("pruning is disabled by OLLAMA_NOPRUNE")
+
+// PruneBlobs returns the digests of blobs that aren't referenced by any
+// manifest and, unless dryRun is set, removes them. Files in the blobs
+// directory that aren't named for a valid digest are ignored. If OLLAMA_NOPRUNE
+// is set, nothing is removed and ErrPruneDisabled is returned along with the
+// unreferenced digests.
+func PruneBlobs(dryRun bool) ([]string, error) {
+	counts, err := BlobReferenceCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var dangling []string
+	for digest, n := range counts {
+		if n == 0 {
+			dangling = append(dangling, digest)
+		}
+	}
+
+	slices.Sort(dangling)
+
+	if dryRun || len(dangling) == 0 {
+		return dangling, nil
+	}
+
+	if envconfig.NoPrune {
+		return dangling, ErrPruneDisabled
+	}
+
+	for _, digest := range dangling {
+		fp, err := ResolveBlobPath(digest)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.Remove(fp); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Info("pruned unused blobs", "count", len(dangling))
+	return dangling, nil
+}
+
 func PruneDirectory(path string) error {
 	info, err := os.Lstat(path)
 	if err != nil {
@@ -793,6 +1005,20 @@ func PruneDirectory(path string) error {
 	return nil
 }
 
+// transferLayers calls transfer for each layer, running at most
+// OLLAMA_MAX_TRANSFERS transfers at once. The first error cancels the rest.
+func transferLayers(ctx context.Context, layers []*Layer, transfer func(context.Context, *Layer) error) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(envconfig.MaxTransfers, 1))
+	for _, layer := range layers {
+		g.Go(func() error {
+			return transfer(ctx, layer)
+		})
+	}
+
+	return g.Wait()
+}
+
 func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
 	mp := ParseModelPath(name)
 	fn(api.ProgressResponse{Status: "retrieving manifest"})
@@ -811,11 +1037,11 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	layers = append(layers, manifest.Layers...)
 	layers = append(layers, manifest.Config)
 
-	for _, layer := range layers {
-		if err := uploadBlob(ctx, mp, layer, regOpts, fn); err != nil {
-			slog.Info(fmt.Sprintf("error uploading blob: %v", err))
-			return err
-		}
+	if err := transferLayers(ctx, layers, func(ctx context.Context, layer *Layer) error {
+		return uploadBlob(ctx, mp, layer, regOpts, fn)
+	}); err != nil {
+		slog.Info(fmt.Sprintf("error uploading blob: %v", err))
+		return err
 	}
 
 	fn(api.ProgressResponse{Status: "pushing manifest"})
@@ -840,6 +1066,32 @@ func PushModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	return nil
 }
 
+// pullSize returns how many bytes pulling layers writes, counting each blob
+// that isn't already downloaded once.
+func pullSize(layers []*Layer) (uint64, error) {
+	var size uint64
+	seen := make(map[string]bool)
+	for _, layer := range layers {
+		if seen[layer.Digest] {
+			continue
+		}
+		seen[layer.Digest] = true
+
+		p, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			size += uint64(layer.Size)
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	return size, nil
+}
+
 func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn func(api.ProgressResponse)) error {
 	mp := ParseModelPath(name)
 
@@ -879,8 +1131,18 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	layers = append(layers, manifest.Layers...)
 	layers = append(layers, manifest.Config)
 
+	needed, err := pullSize(layers)
+	if err != nil {
+		return err
+	}
+
+	if err := CheckDiskSpace(needed); err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
 	skipVerify := make(map[string]bool)
-	for _, layer := range layers {
+	if err := transferLayers(ctx, layers, func(ctx context.Context, layer *Layer) error {
 		cacheHit, err := downloadBlob(ctx, downloadOpts{
 			mp:      mp,
 			digest:  layer.Digest,
@@ -890,8 +1152,14 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		if err != nil {
 			return err
 		}
+
+		mu.Lock()
+		defer mu.Unlock()
 		skipVerify[layer.Digest] = cacheHit
 		delete(deleteMap, layer.Digest)
+		return nil
+	}); err != nil {
+		return err
 	}
 	delete(deleteMap, manifest.Config.Digest)
 
@@ -900,7 +1168,7 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 		if skipVerify[layer.Digest] {
 			continue
 		}
-		if err := verifyBlob(layer.Digest); err != nil {
+		if err := VerifyBlob(layer.Digest); err != nil {
 			if errors.Is(err, errDigestMismatch) {
 				// something went wrong, delete the blob
 				fp, err := GetBlobsPath(layer.Digest)
@@ -932,6 +1200,7 @@ func PullModel(ctx context.Context, name string, regOpts *registryOptions, fn fu
 	}
 
 	err = os.WriteFile(fp, manifestJSON, 0o644)
+	InvalidateManifest(mp)
 	if err != nil {
 		slog.Info(fmt.Sprintf("couldn't write to %s", fp))
 		return err
@@ -1065,6 +1334,16 @@ func makeRequestWithRetry(ctx context.Context, method string, requestURL *url.UR
 	return nil, errUnauthorized
 }
 
+// registryClient sends registry requests through the proxy configured with
+// OLLAMA_PROXY, HTTPS_PROXY or HTTP_PROXY, except to hosts matching NO_PROXY.
+var registryClient = &http.Client{Transport: registryTransport()}
+
+func registryTransport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = envconfig.ProxyFor
+	return t
+}
+
 func makeRequest(ctx context.Context, method string, requestURL *url.URL, headers http.Header, body io.Reader, regOpts *registryOptions) (*http.Response, error) {
 	if requestURL.Scheme != "http" && regOpts != nil && regOpts.Insecure {
 		requestURL.Scheme = "http"
@@ -1098,7 +1377,7 @@ func makeRequest(ctx context.Context, method string, requestURL *url.URL, header
 		req.ContentLength = contentLength
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := registryClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1141,22 +1420,71 @@ func parseRegistryChallenge(authStr string) registryChallenge {
 
 var errDigestMismatch = errors.New("digest mismatch, file must be downloaded again")
 
-func verifyBlob(digest string) error {
-	fp, err := GetBlobsPath(digest)
+// VerifyBlob recomputes the sha256 digest of the blob stored for digest and
+// returns an error wrapping errDigestMismatch if the contents do not match.
+func VerifyBlob(digest string) error {
+	fp, err := ResolveBlobPath(digest)
 	if err != nil {
 		return err
 	}
 
 	f, err := os.Open(fp)
-	if err != nil {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("blob %s not found: %w", digest, err)
+	} else if err != nil {
 		return err
 	}
 	defer f.Close()
 
+	want := strings.Replace(digest, "-", ":", 1)
 	fileDigest, _ := GetSHA256Digest(f)
-	if digest != fileDigest {
-		return fmt.Errorf("%w: want %s, got %s", errDigestMismatch, digest, fileDigest)
+	if want != fileDigest {
+		return fmt.Errorf("%w: want %s, got %s", errDigestMismatch, want, fileDigest)
 	}
 
 	return nil
 }
+
+// WriteBlob streams r into the blob for digest and returns the blob's path.
+// It's written to a temporary file in the blobs directory, hashed as it's
+// written and synced, then renamed into place only if it matches digest, so
+// a crash or a concurrent pull never leaves a partly written blob behind.
+func WriteBlob(digest string, r io.Reader) (string, error) {
+	blob, err := GetBlobsPath(digest)
+	if err != nil {
+		return "", err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(blob), "sha256-")
+	if err != nil {
+		return "", err
+	}
+	defer temp.Close()
+
+	// once renamed there's nothing left to remove
+	defer os.Remove(temp.Name())
+
+	sha256sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(temp, sha256sum), r); err != nil {
+		return "", err
+	}
+
+	want := strings.Replace(digest, "-", ":", 1)
+	if got := fmt.Sprintf("sha256:%x", sha256sum.Sum(nil)); !strings.EqualFold(want, got) {
+		return "", fmt.Errorf("%w: want %s, got %s", errDigestMismatch, want, got)
+	}
+
+	if err := temp.Sync(); err != nil {
+		return "", err
+	}
+
+	if err := temp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(temp.Name(), blob); err != nil {
+		return "", err
+	}
+
+	return blob, nil
+}
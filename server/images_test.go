@@ -0,0 +1,526 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/llm"
+	"github.com/ollama/ollama/types/model"
+)
+
+func createBlob(t *testing.T, data string) string {
+	t.Helper()
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(data)))
+	p, err := GetBlobsPath(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return digest
+}
+
+func TestVerifyBlob(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	digest := createBlob(t, "hello world")
+
+	t.Run("valid", func(t *testing.T) {
+		if err := VerifyBlob(digest); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		p, err := GetBlobsPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, []byte("goodbye world"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := VerifyBlob(digest); !errors.Is(err, errDigestMismatch) {
+			t.Fatalf("expected %v, got %v", errDigestMismatch, err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		missing := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("missing")))
+		if err := VerifyBlob(missing); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %v, got %v", os.ErrNotExist, err)
+		}
+	})
+}
+
+// blobFiles lists the files in the blobs directory.
+func blobFiles(t *testing.T) []string {
+	t.Helper()
+
+	blobs, err := GetBlobsPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names
+}
+
+func TestWriteBlob(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("hello world")))
+
+	t.Run("valid", func(t *testing.T) {
+		p, err := WriteBlob(digest, strings.NewReader("hello world"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := VerifyBlob(digest); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := filepath.Base(p); !slices.Equal(blobFiles(t), []string{want}) {
+			t.Errorf("expected only %s, got %v", want, blobFiles(t))
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		other := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other")))
+		if _, err := WriteBlob(other, strings.NewReader("hello world")); !errors.Is(err, errDigestMismatch) {
+			t.Fatalf("expected %v, got %v", errDigestMismatch, err)
+		}
+
+		p, err := GetBlobsPath(other)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected no blob for %s, got %v", other, err)
+		}
+
+		if len(blobFiles(t)) != 1 {
+			t.Errorf("expected the temporary file to be removed, got %v", blobFiles(t))
+		}
+	})
+
+	t.Run("existing", func(t *testing.T) {
+		p, err := GetBlobsPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the write fails part way through, after checking the existing
+		// blob is untouched while it's in progress
+		r := io.MultiReader(
+			strings.NewReader("hello"),
+			readerFunc(func([]byte) (int, error) {
+				if err := VerifyBlob(digest); err != nil {
+					t.Errorf("existing blob changed mid-write: %v", err)
+				}
+
+				return 0, io.ErrUnexpectedEOF
+			}),
+		)
+
+		if _, err := WriteBlob(digest, r); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+		}
+
+		if err := VerifyBlob(digest); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := filepath.Base(p); !slices.Equal(blobFiles(t), []string{want}) {
+			t.Errorf("expected only %s, got %v", want, blobFiles(t))
+		}
+	})
+
+	t.Run("invalid digest", func(t *testing.T) {
+		if _, err := WriteBlob("sha256:abc", strings.NewReader("hello world")); !errors.Is(err, ErrInvalidDigestFormat) {
+			t.Fatalf("expected %v, got %v", ErrInvalidDigestFormat, err)
+		}
+	})
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestModelSize(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	config := &Layer{MediaType: "application/vnd.docker.container.image.v1+json", Digest: createBlob(t, "{}"), Size: 2}
+	weights := &Layer{MediaType: "application/vnd.ollama.image.model", Digest: createBlob(t, "weights"), Size: 7}
+	template := &Layer{MediaType: "application/vnd.ollama.image.template", Digest: createBlob(t, "{{ .Prompt }}"), Size: 13}
+
+	name := model.ParseName("size")
+	if err := WriteManifest(name, config, []*Layer{weights, template, weights}); err != nil {
+		t.Fatal(err)
+	}
+
+	mp := ParseModelPath(name.String())
+	fp, err := mp.GetManifestPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := ModelSize(mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := fi.Size() + 2 + 7 + 13; size != expect {
+		t.Errorf("expected size %d, got %d", expect, size)
+	}
+
+	p, err := GetBlobsPath(template.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ModelSize(mp); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestBlobReferenceCounts(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	config := &Layer{MediaType: "application/vnd.docker.container.image.v1+json", Digest: createBlob(t, "{}"), Size: 2}
+	shared := &Layer{MediaType: "application/vnd.ollama.image.model", Digest: createBlob(t, "weights"), Size: 7}
+	adapter := &Layer{MediaType: "application/vnd.ollama.image.adapter", Digest: createBlob(t, "adapter"), Size: 7}
+	orphan := createBlob(t, "orphan")
+
+	if err := WriteManifest(model.ParseName("base"), config, []*Layer{shared}); err != nil {
+		t.Fatal(err)
+	}
+
+	// listing the same blob twice only counts once
+	if err := WriteManifest(model.ParseName("tuned"), config, []*Layer{shared, adapter, adapter}); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := BlobReferenceCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]int{
+		config.Digest:  2,
+		shared.Digest:  2,
+		adapter.Digest: 1,
+		orphan:         0,
+	}
+
+	if !maps.Equal(counts, expect) {
+		t.Errorf("expected %v, got %v", expect, counts)
+	}
+}
+
+func TestPruneBlobs(t *testing.T) {
+	setup := func(t *testing.T) (used []string, orphan string) {
+		t.Setenv("OLLAMA_MODELS", t.TempDir())
+		envconfig.LoadConfig()
+
+		config := &Layer{MediaType: "application/vnd.docker.container.image.v1+json", Digest: createBlob(t, "{}"), Size: 2}
+		weights := &Layer{MediaType: "application/vnd.ollama.image.model", Digest: createBlob(t, "weights"), Size: 7}
+		if err := WriteManifest(model.ParseName("prune"), config, []*Layer{weights}); err != nil {
+			t.Fatal(err)
+		}
+
+		// partial downloads aren't valid digests and must be left alone
+		p, err := GetBlobsPath("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(p, weights.Digest[7:]+"-partial"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		return []string{config.Digest, weights.Digest}, createBlob(t, "orphan")
+	}
+
+	blobExists := func(t *testing.T, digest string) bool {
+		p, err := ResolveBlobPath(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = os.Stat(p)
+		return err == nil
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		_, orphan := setup(t)
+
+		dangling, err := PruneBlobs(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(dangling, []string{orphan}) {
+			t.Errorf("expected %v, got %v", []string{orphan}, dangling)
+		}
+
+		if !blobExists(t, orphan) {
+			t.Error("expected dry run to keep orphan")
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		used, orphan := setup(t)
+
+		if _, err := PruneBlobs(false); err != nil {
+			t.Fatal(err)
+		}
+
+		if blobExists(t, orphan) {
+			t.Error("expected orphan to be removed")
+		}
+
+		for _, digest := range used {
+			if !blobExists(t, digest) {
+				t.Errorf("expected %s to be kept", digest)
+			}
+		}
+	})
+
+	t.Run("noprune", func(t *testing.T) {
+		_, orphan := setup(t)
+		t.Setenv("OLLAMA_NOPRUNE", "1")
+		envconfig.LoadConfig()
+
+		dangling, err := PruneBlobs(false)
+		if !errors.Is(err, ErrPruneDisabled) {
+			t.Fatalf("expected %v, got %v", ErrPruneDisabled, err)
+		}
+
+		if !slices.Equal(dangling, []string{orphan}) || !blobExists(t, orphan) {
+			t.Errorf("expected orphan %s to be reported and kept, got %v", orphan, dangling)
+		}
+	})
+}
+
+func TestModelLayerDigest(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	config := &Layer{MediaType: "application/vnd.docker.container.image.v1+json", Digest: createBlob(t, "{}"), Size: 2}
+	weights := &Layer{MediaType: "application/vnd.ollama.image.model", Digest: createBlob(t, "weights"), Size: 7}
+	adapter := &Layer{MediaType: "application/vnd.ollama.image.adapter", Digest: createBlob(t, "adapter"), Size: 7}
+	if err := WriteManifest(model.ParseName("adapted"), config, []*Layer{weights, adapter}); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := ModelLayerDigest(ParseModelPath("adapted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if digest != weights.Digest {
+		t.Errorf("expected %s, got %s", weights.Digest, digest)
+	}
+
+	t.Run("ambiguous", func(t *testing.T) {
+		other := &Layer{MediaType: "application/vnd.ollama.image.model", Digest: createBlob(t, "other weights"), Size: 13}
+		if err := WriteManifest(model.ParseName("ambiguous"), config, []*Layer{weights, other}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ModelLayerDigest(ParseModelPath("ambiguous")); err == nil {
+			t.Error("expected an error for several model layers")
+		}
+	})
+
+	t.Run("no weights", func(t *testing.T) {
+		if err := WriteManifest(model.ParseName("adapter-only"), config, []*Layer{adapter}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ModelLayerDigest(ParseModelPath("adapter-only")); err == nil {
+			t.Error("expected an error for a model without weights")
+		}
+	})
+}
+
+func TestReadModelInfo(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	bts, err := os.ReadFile(createBinFile(t, llm.KV{
+		"general.architecture":    "gemma2",
+		"general.file_type":       uint32(1),
+		"gemma2.context_length":   uint32(8192),
+		"gemma2.embedding_length": uint32(4),
+		"gemma2.block_count":      uint32(1),
+	}, []llm.Tensor{
+		{Name: "token_embd.weight", Shape: []uint64{4, 2}, WriterTo: bytes.NewReader(make([]byte, 4*2*4))},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Layer{MediaType: "application/vnd.docker.container.image.v1+json", Digest: createBlob(t, "{}"), Size: 2}
+	weights := &Layer{MediaType: "application/vnd.ollama.image.model", Digest: createBlob(t, string(bts)), Size: int64(len(bts))}
+	if err := WriteManifest(model.ParseName("info"), config, []*Layer{weights}); err != nil {
+		t.Fatal(err)
+	}
+
+	kv, err := ReadModelInfo(ParseModelPath("info"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kv.Architecture() != "gemma2" {
+		t.Errorf("expected architecture gemma2, got %s", kv.Architecture())
+	}
+
+	if kv.ContextLength() != 8192 {
+		t.Errorf("expected context length 8192, got %d", kv.ContextLength())
+	}
+
+	if kv.ParameterCount() != 8 {
+		t.Errorf("expected 8 parameters, got %d", kv.ParameterCount())
+	}
+
+	if ft := kv.FileType().String(); ft != "F16" {
+		t.Errorf("expected file type F16, got %s", ft)
+	}
+
+	t.Run("corrupt", func(t *testing.T) {
+		weights := &Layer{MediaType: "application/vnd.ollama.image.model", Digest: createBlob(t, "not a gguf"), Size: 10}
+		if err := WriteManifest(model.ParseName("corrupt"), config, []*Layer{weights}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ReadModelInfo(ParseModelPath("corrupt")); err == nil {
+			t.Error("expected an error reading corrupt weights")
+		}
+	})
+
+	t.Run("no weights", func(t *testing.T) {
+		if err := WriteManifest(model.ParseName("empty"), config, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ReadModelInfo(ParseModelPath("empty")); err == nil {
+			t.Error("expected an error for a model without weights")
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := ReadModelInfo(ParseModelPath("missing")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+		}
+	})
+}
+
+func TestTransferLayers(t *testing.T) {
+	t.Cleanup(envconfig.LoadConfig)
+	t.Setenv("OLLAMA_MAX_TRANSFERS", "2")
+	envconfig.LoadConfig()
+
+	layers := make([]*Layer, 8)
+	for i := range layers {
+		layers[i] = &Layer{Digest: fmt.Sprintf("sha256:%064d", i)}
+	}
+
+	t.Run("limit", func(t *testing.T) {
+		var mu sync.Mutex
+		var once sync.Once
+		var running, peak, done int
+		full := make(chan struct{})
+		err := transferLayers(context.Background(), layers, func(ctx context.Context, layer *Layer) error {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			if running == envconfig.MaxTransfers {
+				once.Do(func() { close(full) })
+			}
+			mu.Unlock()
+
+			select {
+			case <-full:
+			case <-time.After(time.Second):
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			running--
+			done++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if done != len(layers) {
+			t.Errorf("expected %d transfers, got %d", len(layers), done)
+		}
+
+		if peak != envconfig.MaxTransfers {
+			t.Errorf("expected at most %d concurrent transfers, got %d", envconfig.MaxTransfers, peak)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errTransfer := errors.New("transfer failed")
+		err := transferLayers(context.Background(), layers, func(ctx context.Context, layer *Layer) error {
+			if layer == layers[0] {
+				return errTransfer
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if !errors.Is(err, errTransfer) {
+			t.Errorf("expected %v, got %v", errTransfer, err)
+		}
+	})
+}
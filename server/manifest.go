@@ -32,11 +32,33 @@ func (m *Manifest) Size() (size int64) {
 	return
 }
 
+// clone returns a copy of m that shares nothing with it, so cached
+// manifests can't be modified through the copies handed out.
+func (m *Manifest) clone() *Manifest {
+	c := *m
+	if m.Config != nil {
+		config := *m.Config
+		c.Config = &config
+	}
+
+	if m.Layers != nil {
+		c.Layers = make([]*Layer, len(m.Layers))
+		for i, l := range m.Layers {
+			layer := *l
+			c.Layers[i] = &layer
+		}
+	}
+
+	return &c
+}
+
 func (m *Manifest) Remove() error {
 	if err := os.Remove(m.filepath); err != nil {
 		return err
 	}
 
+	cachedManifests.invalidate(m.filepath)
+
 	manifests, err := GetManifestPath()
 	if err != nil {
 		return err
@@ -71,7 +93,12 @@ func ParseNamedManifest(n model.Name) (*Manifest, error) {
 
 	var m Manifest
 	f, err := os.Open(p)
-	if err != nil {
+	if errors.Is(err, os.ErrNotExist) && n.Host == DefaultRegistryHost() && n.Host != DefaultRegistry {
+		// models pulled before the default registry was changed are still
+		// kept under DefaultRegistry
+		n.Host = DefaultRegistry
+		return ParseNamedManifest(n)
+	} else if err != nil {
 		return nil, err
 	}
 	defer f.Close()
@@ -109,6 +136,7 @@ func WriteManifest(name model.Name, config *Layer, layers []*Layer) error {
 		return err
 	}
 	defer f.Close()
+	defer cachedManifests.invalidate(p)
 
 	m := Manifest{
 		SchemaVersion: 2,
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// manifestCache is a least recently used cache of parsed manifests keyed by
+// ModelPath.String(). An entry is only used while the manifest file's size
+// and modification time match those it was parsed from. It holds at most
+// OLLAMA_MANIFEST_CACHE_SIZE entries.
+type manifestCache struct {
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type manifestCacheEntry struct {
+	key     string
+	path    string
+	size    int64
+	modTime time.Time
+
+	manifest *Manifest
+	digest   string
+}
+
+var cachedManifests = newManifestCache()
+
+func newManifestCache() *manifestCache {
+	return &manifestCache{
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns a copy of the manifest cached for key if it was parsed from the
+// file at path and that file still matches fi.
+func (c *manifestCache) get(key, path string, fi os.FileInfo) (*Manifest, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, "", false
+	}
+
+	entry := e.Value.(*manifestCacheEntry)
+	if entry.path != path || entry.size != fi.Size() || !entry.modTime.Equal(fi.ModTime()) {
+		c.remove(e)
+		return nil, "", false
+	}
+
+	c.lru.MoveToFront(e)
+	return entry.manifest.clone(), entry.digest, true
+}
+
+// put caches a copy of m, parsed from the file at path described by fi,
+// evicting the least recently used entries beyond the size limit.
+func (c *manifestCache) put(key, path string, fi os.FileInfo, m *Manifest, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+
+	if envconfig.ManifestCacheSize > 0 {
+		c.entries[key] = c.lru.PushFront(&manifestCacheEntry{
+			key:      key,
+			path:     path,
+			size:     fi.Size(),
+			modTime:  fi.ModTime(),
+			manifest: m.clone(),
+			digest:   digest,
+		})
+	}
+
+	for c.lru.Len() > envconfig.ManifestCacheSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate drops every entry parsed from the file at path. Names which
+// differ only by scheme share a file.
+func (c *manifestCache) invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*manifestCacheEntry).path == path {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+func (c *manifestCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*manifestCacheEntry).key)
+}
+
+// InvalidateManifest drops any cached copy of the manifest for mp. It must be
+// called after the manifest is written or removed.
+func InvalidateManifest(mp ModelPath) {
+	fp, err := mp.GetManifestPath()
+	if err != nil {
+		return
+	}
+
+	cachedManifests.invalidate(fp)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/envconfig"
+	"github.com/ollama/ollama/types/model"
+)
+
+func TestManifestCache(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+	t.Cleanup(func() { cachedManifests = newManifestCache() })
+
+	write := func(t *testing.T, name, data string) ModelPath {
+		t.Helper()
+
+		config := &Layer{MediaType: "application/vnd.docker.container.image.v1+json", Digest: createBlob(t, data), Size: int64(len(data))}
+		if err := WriteManifest(model.ParseName(name), config, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		return ParseModelPath(name)
+	}
+
+	get := func(t *testing.T, mp ModelPath) *Manifest {
+		t.Helper()
+
+		m, _, err := GetManifest(mp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return m
+	}
+
+	t.Run("hit", func(t *testing.T) {
+		cachedManifests = newManifestCache()
+		mp := write(t, "hit", "aaaa")
+		fp, err := mp.GetManifestPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := cachedManifests.entries[mp.String()]; ok {
+			t.Fatal("unexpected cache entry before the first read")
+		}
+
+		first := get(t, mp)
+		if _, ok := cachedManifests.entries[mp.String()]; !ok {
+			t.Fatal("expected a cache entry after the first read")
+		}
+
+		// rewrite the file behind the cache's back keeping its size and
+		// modification time so only a cache hit returns the old config
+		bts, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bts = bytes.ReplaceAll(bts, []byte(first.Config.Digest), []byte(createBlob(t, "bbbb")))
+		if err := os.WriteFile(fp, bts, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(fp, fi.ModTime(), fi.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := get(t, mp); got.Config.Digest != first.Config.Digest {
+			t.Errorf("expected a cache hit, got %s", got.Config.Digest)
+		}
+
+		// copies handed out don't share the cached manifest
+		first.Config.Digest = "changed"
+		if got := get(t, mp); got.Config.Digest == "changed" {
+			t.Error("cached manifest was modified through a returned copy")
+		}
+	})
+
+	t.Run("mtime", func(t *testing.T) {
+		cachedManifests = newManifestCache()
+		mp := write(t, "mtime", "cccc")
+		first := get(t, mp)
+
+		fp, err := mp.GetManifestPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the same size but a different modification time
+		bts, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bts = bytes.ReplaceAll(bts, []byte(first.Config.Digest), []byte(createBlob(t, "dddd")))
+		if err := os.WriteFile(fp, bts, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(fp, later, later); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := get(t, mp); got.Config.Digest == first.Config.Digest {
+			t.Error("expected a stale entry to be reread")
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		cachedManifests = newManifestCache()
+		mp := write(t, "invalidate", "eeee")
+		get(t, mp)
+
+		InvalidateManifest(mp)
+		if _, ok := cachedManifests.entries[mp.String()]; ok {
+			t.Error("expected the entry to be dropped")
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		t.Setenv("OLLAMA_MANIFEST_CACHE_SIZE", "2")
+		envconfig.LoadConfig()
+		cachedManifests = newManifestCache()
+
+		a, b, c := write(t, "a", "a"), write(t, "b", "b"), write(t, "c", "c")
+		get(t, a)
+		get(t, b)
+		// a is now the most recently used
+		get(t, a)
+		get(t, c)
+
+		if n := cachedManifests.lru.Len(); n != 2 {
+			t.Errorf("expected 2 entries, got %d", n)
+		}
+
+		for mp, cached := range map[ModelPath]bool{a: true, b: false, c: true} {
+			if _, ok := cachedManifests.entries[mp.String()]; ok != cached {
+				t.Errorf("%s: expected cached %v, got %v", mp, cached, ok)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("OLLAMA_MANIFEST_CACHE_SIZE", "0")
+		envconfig.LoadConfig()
+		cachedManifests = newManifestCache()
+
+		get(t, write(t, "disabled", "ffff"))
+		if n := cachedManifests.lru.Len(); n != 0 {
+			t.Errorf("expected no entries, got %d", n)
+		}
+	})
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/convert"
+	"github.com/ollama/ollama/envconfig"
 	"github.com/ollama/ollama/llm"
 	"github.com/ollama/ollama/template"
 	"github.com/ollama/ollama/types/model"
@@ -149,6 +150,10 @@ func parseFromZipFile(_ context.Context, file *os.File, digest string, fn func(a
 		return nil, err
 	}
 
+	// catch a bad conversion here rather than when the model is loaded
+	params.Verify = true
+	params.TrustRemoteCode = envconfig.TrustRemoteCode
+
 	mArch, err := mf.GetModelArch("", tempDir, params)
 	if err != nil {
 		return nil, err
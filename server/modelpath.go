@@ -1,6 +1,8 @@
 package server
 
 import (
+	"cmp"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"net/url"
@@ -18,6 +20,11 @@ type ModelPath struct {
 	Namespace      string
 	Repository     string
 	Tag            string
+
+	// Digest pins the manifest to the one whose content has this sha256,
+	// e.g. sha256:abc... When it's set, reading the manifest prefers it to
+	// Tag
+	Digest string
 }
 
 const (
@@ -32,12 +39,31 @@ var (
 	ErrInvalidProtocol     = errors.New("invalid protocol scheme")
 	ErrInsecureProtocol    = errors.New("insecure protocol http")
 	ErrInvalidDigestFormat = errors.New("invalid digest format")
+	ErrOutsideSandbox      = errors.New("path is outside the models directory")
 )
 
+// ociSchemes are schemes used by OCI tooling to name a registry. They're
+// kept on the ModelPath so it prints as given but are fetched over https.
+var ociSchemes = map[string]bool{
+	"oci":    true,
+	"docker": true,
+}
+
+// DefaultRegistryHost returns the registry for model names which don't
+// include one, OLLAMA_DEFAULT_REGISTRY if it's set or DefaultRegistry.
+func DefaultRegistryHost() string {
+	return cmp.Or(envconfig.DefaultRegistry, DefaultRegistry)
+}
+
+// ParseModelPath parses name into a ModelPath, filling in defaults for any
+// missing components. The registry host and namespace are case-insensitive
+// and are lowercased; the repository and tag are case-sensitive per the OCI
+// distribution spec and are preserved as given. The oci:// and docker://
+// schemes are accepted and treated as https registries.
 func ParseModelPath(name string) ModelPath {
 	mp := ModelPath{
 		ProtocolScheme: DefaultProtocolScheme,
-		Registry:       DefaultRegistry,
+		Registry:       DefaultRegistryHost(),
 		Namespace:      DefaultNamespace,
 		Repository:     "",
 		Tag:            DefaultTag,
@@ -49,18 +75,19 @@ func ParseModelPath(name string) ModelPath {
 		name = after
 	}
 
-	name = strings.ReplaceAll(name, string(os.PathSeparator), "/")
-	parts := strings.Split(name, "/")
-	switch len(parts) {
-	case 3:
-		mp.Registry = parts[0]
-		mp.Namespace = parts[1]
-		mp.Repository = parts[2]
+	if os.PathSeparator != '/' {
+		name = strings.ReplaceAll(name, string(os.PathSeparator), "/")
+	}
+
+	// cut in place rather than splitting to avoid allocating on every request
+	switch strings.Count(name, "/") {
 	case 2:
-		mp.Namespace = parts[0]
-		mp.Repository = parts[1]
+		mp.Registry, name, _ = strings.Cut(name, "/")
+		mp.Namespace, mp.Repository, _ = strings.Cut(name, "/")
 	case 1:
-		mp.Repository = parts[0]
+		mp.Namespace, mp.Repository, _ = strings.Cut(name, "/")
+	case 0:
+		mp.Repository = name
 	}
 
 	if repo, tag, found := strings.Cut(mp.Repository, ":"); found {
@@ -68,11 +95,56 @@ func ParseModelPath(name string) ModelPath {
 		mp.Tag = tag
 	}
 
+	mp.Registry = strings.ToLower(mp.Registry)
+	mp.Namespace = strings.ToLower(mp.Namespace)
+
 	return mp
 }
 
 var errModelPathInvalid = errors.New("invalid model path")
 
+// ParseModelPathStrict parses name like ParseModelPath but returns an error
+// if name isn't fully qualified, as registry/namespace/repository:tag, rather
+// than filling in defaults for the missing components.
+func ParseModelPathStrict(name string) (ModelPath, error) {
+	mp := ParseModelPath(name)
+
+	rest := name
+	if _, after, found := strings.Cut(rest, "://"); found {
+		rest = after
+	}
+
+	if os.PathSeparator != '/' {
+		rest = strings.ReplaceAll(rest, string(os.PathSeparator), "/")
+	}
+
+	var missing []string
+	switch strings.Count(rest, "/") {
+	case 0:
+		missing = append(missing, "registry", "namespace")
+	case 1:
+		missing = append(missing, "registry")
+	}
+
+	if _, tag, _ := strings.Cut(rest[strings.LastIndex(rest, "/")+1:], ":"); tag == "" {
+		missing = append(missing, "tag")
+	}
+
+	switch len(missing) {
+	case 0:
+	case 1:
+		return ModelPath{}, fmt.Errorf("%w: %q is missing a %s", errModelPathInvalid, name, missing[0])
+	default:
+		return ModelPath{}, fmt.Errorf("%w: %q is missing a %s and %s", errModelPathInvalid, name, strings.Join(missing[:len(missing)-1], ", "), missing[len(missing)-1])
+	}
+
+	if err := mp.Validate(); err != nil {
+		return ModelPath{}, err
+	}
+
+	return mp, nil
+}
+
 func (mp ModelPath) Validate() error {
 	if mp.Repository == "" {
 		return fmt.Errorf("%w: model repository name is required", errModelPathInvalid)
@@ -94,7 +166,7 @@ func (mp ModelPath) GetFullTagname() string {
 }
 
 func (mp ModelPath) GetShortTagname() string {
-	if mp.Registry == DefaultRegistry {
+	if mp.Registry == DefaultRegistryHost() {
 		if mp.Namespace == DefaultNamespace {
 			return fmt.Sprintf("%s:%s", mp.Repository, mp.Tag)
 		}
@@ -110,9 +182,136 @@ func (mp ModelPath) GetManifestPath() (string, error) {
 	return filepath.Join(dir, "manifests", mp.Registry, mp.Namespace, mp.Repository, mp.Tag), nil
 }
 
+// findManifestPath returns the path to read mp's manifest from. A manifest
+// matching mp's Digest is preferred, falling back to its Tag, and it's an
+// error if there's neither or no manifest matches a digest without a tag.
+//
+// When the default registry is changed, stores that haven't been migrated
+// still keep its models under DefaultRegistry, so that path is used if the
+// manifest isn't found at the canonical one. Manifests are always written to
+// the canonical path.
+func (mp ModelPath) findManifestPath() (string, error) {
+	if mp.Digest != "" {
+		fp, err := mp.manifestByDigest()
+		if err != nil {
+			return "", err
+		}
+
+		if fp != "" {
+			return fp, nil
+		}
+
+		if mp.Tag == "" {
+			return "", fmt.Errorf("no manifest for %s matches %s: %w", mp.GetNamespaceRepository(), mp.Digest, os.ErrNotExist)
+		}
+	}
+
+	if mp.Tag == "" {
+		return "", fmt.Errorf("%w: %s has neither a tag nor a digest", errModelPathInvalid, mp.GetNamespaceRepository())
+	}
+
+	fp, err := mp.GetManifestPath()
+	if err != nil {
+		return "", err
+	}
+
+	if mp.Registry != DefaultRegistryHost() || mp.Registry == DefaultRegistry {
+		return fp, nil
+	}
+
+	if _, err := os.Stat(fp); !errors.Is(err, os.ErrNotExist) {
+		return fp, nil
+	}
+
+	legacy := mp
+	legacy.Registry = DefaultRegistry
+	lp, err := legacy.GetManifestPath()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(lp); err != nil {
+		return fp, nil
+	}
+
+	return lp, nil
+}
+
+// manifestByDigest returns the path of the manifest in mp's repository whose
+// content matches mp's Digest, or an empty path if none does.
+func (mp ModelPath) manifestByDigest() (string, error) {
+	if !digestRe.MatchString(mp.Digest) {
+		return "", ErrInvalidDigestFormat
+	}
+
+	want := strings.ToLower(strings.Replace(mp.Digest, "-", ":", 1))
+
+	dir := filepath.Join(envconfig.ModelsDir, "manifests", mp.Registry, mp.Namespace, mp.Repository)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+
+		fp := filepath.Join(dir, e.Name())
+		bts, err := os.ReadFile(fp)
+		if err != nil {
+			return "", err
+		}
+
+		if fmt.Sprintf("sha256:%x", sha256.Sum256(bts)) == want {
+			return fp, nil
+		}
+	}
+
+	return "", nil
+}
+
+// String returns the fully qualified name of mp including its scheme.
+func (mp ModelPath) String() string {
+	return fmt.Sprintf("%s://%s", mp.ProtocolScheme, mp.GetFullTagname())
+}
+
+// Redacted returns mp as String does but with any credentials in the
+// registry, given as user:password@host, removed so it's safe to log.
+func (mp ModelPath) Redacted() string {
+	mp.Registry = mp.host()
+	return mp.String()
+}
+
+// RedactedHost returns mp as Redacted does but with the registry host masked
+// as well, for logging references to internal registries.
+func (mp ModelPath) RedactedHost() string {
+	mp.Registry = "***"
+	return mp.String()
+}
+
+// host returns the registry without any userinfo.
+func (mp ModelPath) host() string {
+	if i := strings.LastIndex(mp.Registry, "@"); i >= 0 {
+		return mp.Registry[i+1:]
+	}
+
+	return mp.Registry
+}
+
+// BaseURL returns the registry endpoint for mp with only the scheme and host
+// set. Callers join the API path onto it; makeRequest downgrades the scheme to
+// http when the request allows an insecure registry.
 func (mp ModelPath) BaseURL() *url.URL {
+	scheme := mp.ProtocolScheme
+	if ociSchemes[scheme] {
+		scheme = "https"
+	}
+
 	return &url.URL{
-		Scheme: mp.ProtocolScheme,
+		Scheme: scheme,
 		Host:   mp.Registry,
 	}
 }
@@ -128,19 +327,29 @@ func GetManifestPath() (string, error) {
 	return path, nil
 }
 
-func GetBlobsPath(digest string) (string, error) {
-	dir := envconfig.ModelsDir
+// digestRe only accepts actual sha256 digests.
+var digestRe = regexp.MustCompile("^sha256[:-][0-9a-fA-F]{64}$")
 
-	// only accept actual sha256 digests
-	pattern := "^sha256[:-][0-9a-fA-F]{64}$"
-	re := regexp.MustCompile(pattern)
+// ResolveBlobPath returns the path to the blob for the given digest without
+// creating or checking for the blobs directory. An empty digest returns the
+// blobs directory itself.
+func ResolveBlobPath(digest string) (string, error) {
+	dir := envconfig.ModelsDir
 
-	if digest != "" && !re.MatchString(digest) {
+	if digest != "" && !digestRe.MatchString(digest) {
 		return "", ErrInvalidDigestFormat
 	}
 
 	digest = strings.ReplaceAll(digest, ":", "-")
-	path := filepath.Join(dir, "blobs", digest)
+	return filepath.Join(dir, "blobs", digest), nil
+}
+
+func GetBlobsPath(digest string) (string, error) {
+	path, err := ResolveBlobPath(digest)
+	if err != nil {
+		return "", err
+	}
+
 	dirPath := filepath.Dir(path)
 	if digest == "" {
 		dirPath = path
@@ -152,3 +361,100 @@ func GetBlobsPath(digest string) (string, error) {
 
 	return path, nil
 }
+
+// IsLocalFilePath reports whether s refers to a file on disk, such as
+// ./model.gguf, ~/model.gguf, /models/model.gguf or file:///models/model.gguf,
+// rather than a model in a registry. Names like ns/repo:tag are never local
+// files. Files outside the models directory are still local files when
+// OLLAMA_SANDBOX is enabled, checkSandbox reports ErrOutsideSandbox for them.
+func IsLocalFilePath(s string) bool {
+	if rest, ok := strings.CutPrefix(s, "file://"); ok {
+		u, err := url.Parse("file://" + rest)
+		return err == nil && u.Path != ""
+	}
+
+	return filepath.IsAbs(s) || hasRelativePrefix(s)
+}
+
+// hasRelativePrefix reports whether s is explicitly a relative or home
+// directory path.
+func hasRelativePrefix(s string) bool {
+	for _, prefix := range []string{".", "..", "~"} {
+		if s == prefix || strings.HasPrefix(s, prefix+"/") || strings.HasPrefix(s, prefix+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkSandbox returns ErrOutsideSandbox if OLLAMA_SANDBOX is enabled and path
+// does not resolve to a location inside the models directory. Symlinks are
+// followed for both, so a link in the models directory can't point outside
+// it and a symlinked models directory still contains its files.
+func checkSandbox(path string) error {
+	if !envconfig.Sandbox {
+		return nil
+	}
+
+	resolved, err := evalSymlinks(expandHome(path))
+	if err != nil {
+		return err
+	}
+
+	models, err := evalSymlinks(envconfig.ModelsDir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(models, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("%w: %s", ErrOutsideSandbox, path)
+	}
+
+	return nil
+}
+
+// expandHome replaces a leading ~ in p with the user's home directory. p is
+// returned as is if it doesn't start with ~ or there's no home directory.
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") && !strings.HasPrefix(p, "~"+string(filepath.Separator)) {
+		return p
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+
+	return filepath.Join(home, p[1:])
+}
+
+// evalSymlinks returns the absolute path p refers to once any symlinks are
+// followed. Trailing components that don't exist yet are kept as given after
+// the deepest ancestor that does, so paths about to be created can be
+// checked too.
+func evalSymlinks(p string) (string, error) {
+	abspath, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(abspath)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(abspath)
+		if parent == abspath {
+			return filepath.Join(append([]string{abspath}, missing...)...), nil
+		}
+
+		missing = append([]string{filepath.Base(abspath)}, missing...)
+		abspath = parent
+	}
+}
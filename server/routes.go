@@ -3,6 +3,7 @@ package server
 import (
 	"cmp"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"net"
 	"net/http"
 	"net/netip"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -936,6 +938,18 @@ func allowedHost(host string) bool {
 	return false
 }
 
+// isLoopbackOrigin reports whether origin is an http or https origin on a
+// loopback address, e.g. http://127.0.0.2:8080 or http://[::1]
+func isLoopbackOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(u.Hostname())
+	return err == nil && addr.IsLoopback()
+}
+
 func allowedHostsMiddleware(addr net.Addr) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if addr == nil {
@@ -974,6 +988,24 @@ func allowedHostsMiddleware(addr net.Addr) gin.HandlerFunc {
 	}
 }
 
+// apiKeyMiddleware rejects requests without a bearer token matching
+// OLLAMA_API_KEY, if one is set. The root and version endpoints stay open so
+// they can be used as health checks.
+func apiKeyMiddleware(c *gin.Context) {
+	if envconfig.APIKey == "" || c.Request.URL.Path == "/" || c.Request.URL.Path == "/api/version" {
+		c.Next()
+		return
+	}
+
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(envconfig.APIKey)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing api key"})
+		return
+	}
+
+	c.Next()
+}
+
 func (s *Server) GenerateRoutes() http.Handler {
 	config := cors.DefaultConfig()
 	config.AllowWildcard = true
@@ -984,11 +1016,14 @@ func (s *Server) GenerateRoutes() http.Handler {
 		config.AllowHeaders = append(config.AllowHeaders, "x-stainless-"+prop)
 	}
 	config.AllowOrigins = envconfig.AllowOrigins
+	// the default origins only list 127.0.0.1 but any loopback address is local
+	config.AllowOriginFunc = isLoopbackOrigin
 
 	r := gin.Default()
 	r.Use(
 		cors.New(config),
 		allowedHostsMiddleware(s.addr),
+		apiKeyMiddleware,
 	)
 
 	r.POST("/api/pull", s.PullModelHandler)
@@ -1030,7 +1065,7 @@ func Serve(ln net.Listener) error {
 		level = slog.LevelDebug
 	}
 
-	slog.Info("server config", "env", envconfig.Values())
+	slog.Info("server config", "env", envconfig.ValuesSorted())
 	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
 		Level:     level,
 		AddSource: true,
@@ -1046,6 +1081,10 @@ func Serve(ln net.Listener) error {
 
 	slog.SetDefault(slog.New(handler))
 
+	if err := envconfig.ValidateModelsDir(); err != nil {
+		return err
+	}
+
 	blobsDir, err := GetBlobsPath("")
 	if err != nil {
 		return err
@@ -1107,6 +1146,7 @@ func Serve(ln net.Listener) error {
 	}
 
 	s.sched.Run(schedCtx)
+	go s.preloadModels(schedCtx)
 
 	// At startup we retrieve GPU information so we can get log messages before loading a model
 	// This will log warnings to the log in case we have problems with detected GPUs
@@ -1123,6 +1163,46 @@ func Serve(ln net.Listener) error {
 	return nil
 }
 
+// preloadModels loads each model in OLLAMA_PRELOAD_MODELS, one at a time, so
+// the first request for it doesn't wait on the load. Failures are logged.
+func (s *Server) preloadModels(ctx context.Context) {
+	for _, name := range envconfig.PreloadModels {
+		if err := s.preloadModel(ctx, name); err != nil {
+			slog.Warn("failed to preload model", "model", name, "error", err)
+			continue
+		}
+
+		slog.Info("preloaded model", "model", name)
+	}
+}
+
+func (s *Server) preloadModel(ctx context.Context, name string) error {
+	model, err := GetModel(name)
+	if err != nil {
+		return err
+	}
+
+	opts, err := modelOptions(model, nil)
+	if err != nil {
+		return err
+	}
+
+	// the runner is released once the request's context is done, the model
+	// then stays loaded for the usual keep alive
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rCh, eCh := s.sched.GetRunner(ctx, model, opts, nil)
+	select {
+	case <-rCh:
+		return nil
+	case err := <-eCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func waitForStream(c *gin.Context, ch chan interface{}) {
 	c.Header("Content-Type", "application/json")
 	for resp := range ch {
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -568,3 +569,33 @@ func TestCreateDetectTemplate(t *testing.T) {
 		})
 	})
 }
+
+func TestCreateOutsideSandbox(t *testing.T) {
+	t.Cleanup(envconfig.LoadConfig)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	t.Setenv("OLLAMA_SANDBOX", "1")
+	envconfig.LoadConfig()
+
+	outside := t.TempDir()
+	existing := filepath.Join(outside, "model.gguf")
+	if err := os.WriteFile(existing, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var s Server
+
+	// a file outside the sandbox is refused the same way whether or not it
+	// exists so its existence can't be probed
+	for _, fp := range []string{existing, filepath.Join(outside, "missing.gguf")} {
+		w := createRequest(t, s.CreateModelHandler, api.CreateRequest{
+			Name:      "test",
+			Modelfile: fmt.Sprintf("FROM %s", fp),
+		})
+
+		if !strings.Contains(w.Body.String(), ErrOutsideSandbox.Error()) {
+			t.Errorf("%s: expected %q, got %s", fp, ErrOutsideSandbox, w.Body.String())
+		}
+	}
+}
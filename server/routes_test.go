@@ -3,16 +3,21 @@ package server
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -420,3 +425,149 @@ func TestShow(t *testing.T) {
 		t.Fatal("Expected projector architecture to be 'clip', but got", resp.ProjectorInfo["general.architecture"])
 	}
 }
+
+func TestLoopbackOrigins(t *testing.T) {
+	envconfig.LoadConfig()
+
+	s := &Server{}
+	router := s.GenerateRoutes()
+
+	cases := map[string]bool{
+		"http://127.0.0.1":       true,
+		"http://127.0.0.2":       true,
+		"http://127.0.0.2:8080":  true,
+		"http://[::1]":           true,
+		"http://[::1]:11434":     true,
+		"https://[::1]:11434":    true,
+		"http://ollama.test":     false,
+		"http://127.example.com": false,
+		"ftp://127.0.0.2":        false,
+	}
+
+	for origin, allowed := range cases {
+		t.Run(origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/version", nil)
+			req.Header.Set("Origin", origin)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if allowed {
+				require.Equal(t, http.StatusOK, w.Code)
+				require.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				require.Equal(t, http.StatusForbidden, w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	t.Setenv("OLLAMA_API_KEY", "s3cret")
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	envconfig.LoadConfig()
+
+	s := &Server{}
+	router := s.GenerateRoutes()
+
+	cases := []struct {
+		name   string
+		path   string
+		auth   string
+		expect int
+	}{
+		{"health", "/", "", http.StatusOK},
+		{"version", "/api/version", "", http.StatusOK},
+		{"missing", "/api/tags", "", http.StatusUnauthorized},
+		{"wrong", "/api/tags", "Bearer nope", http.StatusUnauthorized},
+		{"basic", "/api/tags", "Basic czNjcmV0", http.StatusUnauthorized},
+		{"valid", "/api/tags", "Bearer s3cret", http.StatusOK},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.expect, w.Code)
+		})
+	}
+}
+
+func TestDefaultRegistryRoundTrip(t *testing.T) {
+	// reload once the environment is restored so later tests see the default
+	t.Cleanup(envconfig.LoadConfig)
+
+	weights, err := os.ReadFile(createBinFile(t, llm.KV{"general.architecture": "test"}, nil))
+	require.NoError(t, err)
+
+	blobs := make(map[string][]byte)
+	layer := func(mediaType string, data []byte) *Layer {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+		blobs[digest] = data
+		return &Layer{MediaType: mediaType, Digest: digest, Size: int64(len(data))}
+	}
+
+	manifest, err := json.Marshal(Manifest{
+		SchemaVersion: 2,
+		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
+		Config:        layer("application/vnd.docker.container.image.v1+json", []byte(`{"model_format":"gguf","model_family":"test"}`)),
+		Layers:        []*Layer{layer("application/vnd.ollama.image.model", weights)},
+	})
+	require.NoError(t, err)
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/library/foo/manifests/latest":
+			w.Write(manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/library/foo/blobs/"):
+			data, ok := blobs[path.Base(r.URL.Path)]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+
+	u, err := url.Parse(registry.URL)
+	require.NoError(t, err)
+
+	p := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", p)
+	t.Setenv("OLLAMA_DEFAULT_REGISTRY", u.Host)
+	envconfig.LoadConfig()
+
+	var s Server
+
+	w := createRequest(t, s.PullModelHandler, api.PullRequest{Model: "foo", Insecure: true})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), `"error"`)
+
+	checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{
+		filepath.Join(p, "manifests", u.Host, "library", "foo", "latest"),
+	})
+
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Model: "foo"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp api.ShowResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, "test", resp.ModelInfo["general.architecture"])
+
+	w = createRequest(t, s.DeleteModelHandler, api.DeleteRequest{Model: "foo"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	checkFileExists(t, filepath.Join(p, "manifests", "*", "*", "*", "*"), []string{})
+
+	w = createRequest(t, s.ShowModelHandler, api.ShowRequest{Model: "foo"})
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+}
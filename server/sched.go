@@ -44,6 +44,10 @@ type Scheduler struct {
 	getGpuFn     func() gpu.GpuInfoList
 	getCpuFn     func() gpu.GpuInfoList
 	reschedDelay time.Duration
+
+	// gpuCount is the number of GPUs seen on the last GPU load, used to
+	// turn the per GPU OLLAMA_MAX_LOADED_MODELS into a total
+	gpuCount int
 }
 
 // Default automatic value for number of models we allow per GPU
@@ -157,17 +161,23 @@ func (s *Scheduler) processPending(ctx context.Context) {
 						pending.useLoadedRunner(runner, s.finishedReqCh)
 						break
 					}
-				} else if envconfig.MaxRunners > 0 && loadedCount >= envconfig.MaxRunners {
+				} else if maxLoaded := envconfig.MaxLoadedModelsTotal(s.gpuCount); maxLoaded > 0 && loadedCount >= maxLoaded {
 					slog.Debug("max runners achieved, unloading one to make room", "runner_count", loadedCount)
 					runnerToExpire = s.findRunnerToUnload()
 				} else {
 					// Either no models are loaded or below envconfig.MaxRunners
 					// Get a refreshed GPU list
 					var gpus gpu.GpuInfoList
+					if envconfig.DisableGPU {
+						// OLLAMA_DISABLE_GPU takes precedence over num_gpu
+						pending.opts.NumGPU = 0
+					}
+
 					if pending.opts.NumGPU == 0 {
 						gpus = s.getCpuFn()
 					} else {
 						gpus = s.getGpuFn()
+						s.gpuCount = len(gpus)
 					}
 
 					if envconfig.MaxRunners <= 0 {
@@ -182,11 +192,11 @@ func (s *Scheduler) processPending(ctx context.Context) {
 							}
 						}
 						if allReliable {
-							envconfig.MaxRunners = defaultModelsPerGPU * len(gpus)
+							envconfig.MaxRunners = defaultModelsPerGPU
 							slog.Debug("updating default concurrency", "OLLAMA_MAX_LOADED_MODELS", envconfig.MaxRunners, "gpu_count", len(gpus))
 						} else {
 							slog.Info("one or more GPUs detected that are unable to accurately report free memory - disabling default concurrency")
-							envconfig.MaxRunners = len(gpus)
+							envconfig.MaxRunners = 1
 						}
 					}
 
@@ -416,7 +426,7 @@ func (pending *LlmRequest) useLoadedRunner(runner *runnerRef, finished chan *Llm
 		runner.expireTimer = nil
 	}
 	if pending.sessionDuration != nil {
-		runner.sessionDuration = pending.sessionDuration.Duration
+		runner.sessionDuration = envconfig.ResolveKeepAlive(&pending.sessionDuration.Duration)
 	}
 	pending.successCh <- runner
 	go func() {
@@ -430,10 +440,11 @@ func (s *Scheduler) load(req *LlmRequest, ggml *llm.GGML, gpus gpu.GpuInfoList,
 	if numParallel < 1 {
 		numParallel = 1
 	}
-	sessionDuration := envconfig.KeepAlive
+	var requested *time.Duration
 	if req.sessionDuration != nil {
-		sessionDuration = req.sessionDuration.Duration
+		requested = &req.sessionDuration.Duration
 	}
+	sessionDuration := envconfig.ResolveKeepAlive(requested)
 	llama, err := s.newServerFn(gpus, req.model.ModelPath, ggml, req.model.AdapterPaths, req.model.ProjectorPaths, req.opts, numParallel)
 	if err != nil {
 		// some older models are not compatible with newer versions of llama.cpp
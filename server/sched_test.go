@@ -676,3 +676,52 @@ func (s *mockLlm) Close() error {
 func (s *mockLlm) EstimatedVRAM() uint64                  { return s.estimatedVRAM }
 func (s *mockLlm) EstimatedTotal() uint64                 { return s.estimatedTotal }
 func (s *mockLlm) EstimatedVRAMByGPU(gpuid string) uint64 { return s.estimatedVRAMByGPU[gpuid] }
+
+func TestDisableGPU(t *testing.T) {
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+
+	t.Setenv("OLLAMA_DISABLE_GPU", "1")
+	envconfig.LoadConfig()
+	t.Cleanup(func() {
+		os.Unsetenv("OLLAMA_DISABLE_GPU")
+		envconfig.LoadConfig()
+	})
+
+	scenario := newScenario(t, ctx, "ollama-model-cpu", 10)
+	scenario.req.opts.NumGPU = 99
+
+	s := InitScheduler(ctx)
+	s.getGpuFn = func() gpu.GpuInfoList {
+		t.Error("unexpected GPU discovery")
+		return nil
+	}
+	s.getCpuFn = func() gpu.GpuInfoList {
+		g := gpu.GpuInfo{Library: "cpu"}
+		g.TotalMemory = 32 * format.GigaByte
+		g.FreeMemory = 26 * format.GigaByte
+		return []gpu.GpuInfo{g}
+	}
+
+	var loadedGPUs gpu.GpuInfoList
+	s.newServerFn = func(gpus gpu.GpuInfoList, model string, ggml *llm.GGML, adapters []string, projectors []string, opts api.Options, numParallel int) (llm.LlamaServer, error) {
+		loadedGPUs = gpus
+		return scenario.srv, nil
+	}
+
+	s.pendingReqCh <- scenario.req
+	s.Run(ctx)
+
+	select {
+	case resp := <-scenario.req.successCh:
+		require.Equal(t, scenario.srv, resp.llama)
+		require.Len(t, loadedGPUs, 1)
+		require.Equal(t, "cpu", loadedGPUs[0].Library)
+		require.Equal(t, 0, scenario.req.opts.NumGPU)
+	case err := <-scenario.req.errCh:
+		t.Fatal(err.Error())
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+	scenario.ctxDone()
+}
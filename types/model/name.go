@@ -35,15 +35,24 @@ func Unqualified(n Name) error {
 const MissingPart = "!MISSING!"
 
 const (
-	defaultHost      = "registry.ollama.ai"
 	defaultNamespace = "library"
 	defaultTag       = "latest"
 )
 
+// defaultHost is the host of names parsed without one. It is
+// "registry.ollama.ai" unless changed with [SetDefaultHost].
+var defaultHost = "registry.ollama.ai"
+
+// SetDefaultHost sets the host used for names parsed without one, such as
+// from OLLAMA_DEFAULT_REGISTRY. An empty host restores "registry.ollama.ai".
+func SetDefaultHost(host string) {
+	defaultHost = cmp.Or(host, "registry.ollama.ai")
+}
+
 // DefaultName returns a name with the default values for the host, namespace,
 // and tag parts. The model and digest parts are empty.
 //
-//   - The default host is ("registry.ollama.ai")
+//   - The default host is ("registry.ollama.ai"), or as set by [SetDefaultHost]
 //   - The default namespace is ("library")
 //   - The default tag is ("latest")
 func DefaultName() Name {